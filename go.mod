@@ -12,8 +12,11 @@ require (
 	github.com/joho/godotenv v1.5.1
 	github.com/kr/pretty v0.3.0 // indirect
 	github.com/pion/ice/v2 v2.3.11 // indirect
+	github.com/pion/ice/v3 v3.0.0
+	github.com/pion/interceptor v0.1.18
 	github.com/pion/mediadevices v0.4.0
 	github.com/pion/rtcp v1.2.10
+	github.com/pion/rtp v1.8.1
 	github.com/pion/srtp/v2 v2.0.17 // indirect
 	github.com/pion/udp v0.1.4 // indirect
 	github.com/pion/udp/v2 v2.0.1 // indirect
@@ -22,7 +25,7 @@ require (
 	github.com/stianeikeland/go-rpio/v4 v4.6.0
 	github.com/tarm/serial v0.0.0-20180830185346-98f6abe2eb07
 	github.com/zeromq/goczmq v4.1.0+incompatible
-	golang.org/x/image v0.12.0 // indirect
+	golang.org/x/image v0.12.0
 	golang.org/x/mobile v0.0.0-20230901161150-52620a4a7557 // indirect
 	golang.org/x/sys v0.12.0 // indirect
 	gopkg.in/hraban/opus.v2 v2.0.0-20230706205704-edec55a8f5da
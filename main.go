@@ -4,15 +4,31 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"time"
 
 	jwt "github.com/golang-jwt/jwt"
 	"github.com/joho/godotenv"
 
 	"github.com/roboportal/bot_box/pkg/arena"
+	"github.com/roboportal/bot_box/pkg/audioout"
+	"github.com/roboportal/bot_box/pkg/broadcast"
 	"github.com/roboportal/bot_box/pkg/communicator"
 	"github.com/roboportal/bot_box/pkg/consoleoutput"
+	"github.com/roboportal/bot_box/pkg/iceconfig"
 	"github.com/roboportal/bot_box/pkg/ipc"
+	"github.com/roboportal/bot_box/pkg/joystick"
+	"github.com/roboportal/bot_box/pkg/macro"
+	"github.com/roboportal/bot_box/pkg/micproc"
+	"github.com/roboportal/bot_box/pkg/osd"
+	"github.com/roboportal/bot_box/pkg/permissions"
+	"github.com/roboportal/bot_box/pkg/pipesink"
+	"github.com/roboportal/bot_box/pkg/pipesource"
+	"github.com/roboportal/bot_box/pkg/recorder"
+	"github.com/roboportal/bot_box/pkg/rtspserver"
 	"github.com/roboportal/bot_box/pkg/serial"
+	"github.com/roboportal/bot_box/pkg/snapshot"
+	"github.com/roboportal/bot_box/pkg/standalone"
+	"github.com/roboportal/bot_box/pkg/utils"
 )
 
 const (
@@ -55,6 +71,12 @@ func main() {
 
 	frameFormat := os.Getenv("frame_format")
 
+	cameras, err := arena.ParseCameras(utils.GetEnvList("video_cameras"))
+
+	if err != nil {
+		panic(err)
+	}
+
 	videoWidth, err := strconv.ParseInt(os.Getenv("video_width"), 10, 32)
 	if err != nil {
 		panic(err)
@@ -92,6 +114,12 @@ func main() {
 
 	robotIPCHost := os.Getenv("robot_ipc_host")
 
+	isJoystickEnabled := utils.GetEnvBool("joystick_enabled", false)
+
+	macrosPath := utils.GetEnvString("macros_path", "")
+
+	osdLayoutPath := utils.GetEnvString("osd_layout", "")
+
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
 		"publicKey": publicKey,
 	})
@@ -102,22 +130,209 @@ func main() {
 		panic(err)
 	}
 
+	var _joystick *joystick.AJoystick
+
+	if isJoystickEnabled {
+		_joystick = joystick.Factory(
+			utils.GetEnvInt("joystick_address", 0),
+			utils.GetEnvString("joystick_priority", joystick.Fallback),
+		)
+	}
+
+	var macros macro.Config
+
+	if macrosPath != "" {
+		macros, err = macro.Load(macrosPath)
+
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	var overlay *osd.AnOverlay
+
+	if osdLayoutPath != "" {
+		layout, err := osd.Load(osdLayoutPath)
+
+		if err != nil {
+			panic(err)
+		}
+
+		overlay = osd.Factory(layout)
+	}
+
+	tokenVerifier, err := permissions.Factory(permissions.InitParams{
+		Secret:        utils.GetEnvString("operator_token_secret", ""),
+		PublicKeyPath: utils.GetEnvString("operator_token_public_key", ""),
+		IsRequired:    utils.GetEnvBool("operator_token_required", false),
+	})
+
+	if err != nil {
+		panic(err)
+	}
+
 	arenaParams := arena.InitParams{
 		StunUrls:    stunUrls,
 		TokenString: tokenString,
 		PublicKey:   publicKey,
 
-		VideoCodecBitRate: int(videoCodecBitRate),
-		FrameFormat:       frameFormat,
-		VideoWidth:        int(videoWidth),
-		VideoFrameRate:    int(videoFrameRate),
+		TurnUrls:                    utils.GetEnvList("turn_urls"),
+		TurnUsername:                utils.GetEnvString("turn_username", ""),
+		TurnCredential:              utils.GetEnvString("turn_credential", ""),
+		ICETransportPolicy:          utils.GetEnvString("ice_transport_policy", iceconfig.PolicyAll),
+		IsPlatformICEServersEnabled: utils.GetEnvBool("turn_platform_credentials", false),
+
+		ICENetwork: arena.ICENetworkParams{
+			Interfaces:           utils.GetEnvList("ice_interfaces"),
+			ExcludedInterfaces:   utils.GetEnvList("ice_excluded_interfaces"),
+			UDPPortMin:           utils.GetEnvInt("ice_udp_port_min", 0),
+			UDPPortMax:           utils.GetEnvInt("ice_udp_port_max", 0),
+			NAT1To1IPs:           utils.GetEnvList("ice_nat_1to1_ips"),
+			NAT1To1CandidateType: utils.GetEnvString("ice_nat_1to1_candidate_type", "host"),
+			MDNSMode:             utils.GetEnvString("ice_mdns", ""),
+			IsIPv6Enabled:        utils.GetEnvBool("ice_ipv6", true),
+			UDPMuxPort:           utils.GetEnvInt("ice_udp_mux_port", 0),
+		},
+		ICERestartGracePeriodSec: utils.GetEnvInt("ice_restart_grace_period_sec", 0),
+
+		VideoCodecBitRate:     int(videoCodecBitRate),
+		VideoCodecs:           utils.GetEnvList("video_codecs"),
+		VideoKeyFrameInterval: utils.GetEnvInt("video_keyframe_interval", 0),
+		VPXRateControl:        utils.GetEnvString("vpx_rate_control", ""),
+		X264Preset:            utils.GetEnvString("x264_preset", ""),
+		OpenH264RateControl:   utils.GetEnvString("openh264_rate_control", ""),
+		H264Profile:           utils.GetEnvString("h264_profile", ""),
+		FrameFormat:           frameFormat,
+		Cameras:               cameras,
+		VideoSource:           utils.GetEnvString("video_source", arena.CameraSource),
+		VideoWidth:            int(videoWidth),
+		VideoFrameRate:        int(videoFrameRate),
+
+		PipeSource: pipesource.Params{
+			Type:              utils.GetEnvString("pipe_type", pipesource.TypeFifo),
+			Path:              utils.GetEnvString("pipe_path", ""),
+			Format:            utils.GetEnvString("pipe_format", pipesource.FormatI420),
+			Codec:             utils.GetEnvString("pipe_codec", "vp8"),
+			Width:             utils.GetEnvInt("pipe_width", 0),
+			Height:            utils.GetEnvInt("pipe_height", 0),
+			FrameRate:         utils.GetEnvFloat("pipe_frame_rate", float64(videoFrameRate)),
+			RestartTimeoutSec: utils.GetEnvInt("pipe_restart_timeout_sec", 1),
+		},
+
+		IsPerPeerEncodingEnabled:    utils.GetEnvBool("video_per_peer_encoding", false),
+		IsAdaptiveBitRateEnabled:    utils.GetEnvBool("video_adaptive_bit_rate", false),
+		VideoMinBitRate:             utils.GetEnvInt("video_min_bit_rate", 150000),
+		VideoMaxBitRate:             utils.GetEnvInt("video_max_bit_rate", int(videoCodecBitRate)),
+		IsAdaptiveResolutionEnabled: utils.GetEnvBool("video_adaptive_resolution", false),
+		IsAdaptiveFrameRateEnabled:  utils.GetEnvBool("video_adaptive_frame_rate", false),
 
 		IsAudioInputEnabled:  isAudioInputEnabled,
 		IsAudioOutputEnabled: isAudioOutputEnabled,
+		AudioSource:          utils.GetEnvString("audio_source", arena.MicrophoneSource),
+		AudioOutput: audioout.Config{
+			Card:       utils.GetEnvString("audio_output_card", ""),
+			Device:     utils.GetEnvString("audio_output_device", ""),
+			SampleRate: utils.GetEnvInt("audio_output_sample_rate", audioout.SourceSampleRate),
+			Gain:       utils.GetEnvFloat("audio_output_gain_db", 0),
+		},
+		AudioPipe: pipesource.AudioParams{
+			Type:              utils.GetEnvString("audio_pipe_type", pipesource.TypeFifo),
+			Path:              utils.GetEnvString("audio_pipe_path", ""),
+			SampleRate:        utils.GetEnvInt("audio_pipe_sample_rate", 48000),
+			Channels:          utils.GetEnvInt("audio_pipe_channels", 1),
+			IsMixed:           utils.GetEnvBool("audio_pipe_mix_microphone", false),
+			RestartTimeoutSec: utils.GetEnvInt("pipe_restart_timeout_sec", 1),
+		},
+		AudioProcessing: micproc.Config{
+			IsHighPassEnabled:  utils.GetEnvBool("audio_high_pass_enabled", false),
+			HighPassCutoff:     utils.GetEnvFloat("audio_high_pass_cutoff_hz", 150),
+			IsNoiseGateEnabled: utils.GetEnvBool("audio_noise_gate_enabled", false),
+			NoiseGateThreshold: utils.GetEnvFloat("audio_noise_gate_threshold_db", -45),
+			IsAGCEnabled:       utils.GetEnvBool("audio_agc_enabled", false),
+			AGCTarget:          utils.GetEnvFloat("audio_agc_target_db", -18),
+			AGCMaxGain:         utils.GetEnvFloat("audio_agc_max_gain_db", 20),
+		},
+		AudioSink: pipesink.Params{
+			Type:              utils.GetEnvString("audio_sink_type", pipesource.TypeFifo),
+			Path:              utils.GetEnvString("audio_sink_path", ""),
+			RestartTimeoutSec: utils.GetEnvInt("pipe_restart_timeout_sec", 1),
+		},
+		SoundClips: audioout.ClipsConfig{
+			Directory: utils.GetEnvString("sound_clips_directory", ""),
+			Events: map[string]string{
+				audioout.EventOperatorConnected: utils.GetEnvString("sound_on_operator_connected", ""),
+				audioout.EventControlsEnabled:   utils.GetEnvString("sound_on_controls_enabled", ""),
+				audioout.EventLinkLost:          utils.GetEnvString("sound_on_link_lost", ""),
+			},
+		},
+
+		TestPatternLabel: utils.GetEnvString("test_pattern_label", ""),
+		ToneFrequency:    utils.GetEnvFloat("tone_frequency", 440),
+
+		Overlay: overlay,
+
+		Recording: recorder.Config{
+			IsEnabled:   utils.GetEnvBool("recording_enabled", false),
+			IsAutoStart: utils.GetEnvBool("recording_auto_start", true),
+			Directory:   utils.GetEnvString("recording_directory", "recordings"),
+			MaxSizeMB:   utils.GetEnvInt("recording_max_size_mb", 0),
+		},
+
+		Snapshot: snapshot.Config{
+			Format:    utils.GetEnvString("snapshot_format", snapshot.FormatJPEG),
+			Quality:   utils.GetEnvInt("snapshot_quality", 90),
+			Directory: utils.GetEnvString("snapshot_directory", ""),
+		},
+
+		Broadcast: arena.BroadcastParams{
+			WHIP: broadcast.WHIPParams{
+				URL:               utils.GetEnvString("whip_url", ""),
+				Token:             utils.GetEnvString("whip_token", ""),
+				ReconnectInterval: time.Duration(utils.GetEnvInt("whip_reconnect_interval_sec", 5)) * time.Second,
+			},
+			WHEP: broadcast.WHEPParams{
+				Address:    utils.GetEnvString("whep_address", ""),
+				Token:      utils.GetEnvString("whep_token", ""),
+				MaxViewers: utils.GetEnvInt("whep_max_viewers", 5),
+			},
+			Camera: utils.GetEnvString("broadcast_camera", ""),
+		},
+
+		RTSP: rtspserver.Params{
+			Address:    utils.GetEnvString("rtsp_address", ""),
+			Path:       utils.GetEnvString("rtsp_path", "camera"),
+			Username:   utils.GetEnvString("rtsp_username", ""),
+			Password:   utils.GetEnvString("rtsp_password", ""),
+			MaxViewers: utils.GetEnvInt("rtsp_max_viewers", 3),
+		},
+		RTSPCamera: utils.GetEnvString("rtsp_camera", ""),
+
+		Macros: macros,
+
+		TokenVerifier: tokenVerifier,
+	}
+
+	if _joystick != nil {
+		arenaParams.IsLocalControlActive = _joystick.IsOverriding
 	}
 
 	_arena := arena.Factory(arenaParams)
 
+	if _joystick != nil {
+		joystickParams := joystick.RunParams{
+			Device:                utils.GetEnvString("joystick_device", "/dev/input/event0"),
+			MappingPath:           utils.GetEnvString("joystick_mapping", "joystick_mapping.json"),
+			SendIntervalMs:        utils.GetEnvInt("joystick_send_interval_ms", 50),
+			IdleTimeoutMs:         utils.GetEnvInt("joystick_idle_timeout_ms", 2000),
+			ReconnectTimeoutSec:   3,
+			SendChan:              _arena.BotCommandsWriteChan,
+			IsRemoteControlActive: _arena.IsRemoteControlActive,
+			OnTakeOver:            _arena.AbortMacro,
+		}
+
+		go _joystick.Run(joystickParams)
+	}
+
 	if outputMode == Serial {
 		serialParams := serial.InitParams{
 			PortName:    portName,
@@ -150,19 +365,35 @@ func main() {
 		go consoleoutput.Init(consoleParams)
 	}
 
-	communicatorParams := communicator.InitParams{
-		PlatformUri:         srvURL,
-		ReceiveChan:         _arena.WSReadChan,
-		SendChan:            _arena.WSWriteChan,
-		ReconnectTimeoutSec: 3,
-		PingIntervalSec:     1,
-		SendTimeoutSec:      1,
-		TokenString:         tokenString,
-		PublicKey:           publicKey,
-		ConStatChan:         _arena.WSConStatChan,
-	}
+	if utils.GetEnvBool("standalone", false) {
+		standaloneParams := standalone.InitParams{
+			Address:            utils.GetEnvString("standalone_address", ":8443"),
+			CertFile:           utils.GetEnvString("standalone_cert_file", ""),
+			KeyFile:            utils.GetEnvString("standalone_key_file", ""),
+			AccessKey:          utils.GetEnvString("standalone_access_key", ""),
+			BotsCount:          utils.GetEnvInt("standalone_bots", 1),
+			AreControlsAllowed: true,
+			ReceiveChan:        _arena.WSReadChan,
+			SendChan:           _arena.WSWriteChan,
+			ConStatChan:        _arena.WSConStatChan,
+		}
+
+		go standalone.Init(standaloneParams)
+	} else {
+		communicatorParams := communicator.InitParams{
+			PlatformUri:         srvURL,
+			ReceiveChan:         _arena.WSReadChan,
+			SendChan:            _arena.WSWriteChan,
+			ReconnectTimeoutSec: 3,
+			PingIntervalSec:     1,
+			SendTimeoutSec:      1,
+			TokenString:         tokenString,
+			PublicKey:           publicKey,
+			ConStatChan:         _arena.WSConStatChan,
+		}
 
-	go communicator.Init(communicatorParams)
+		go communicator.Init(communicatorParams)
+	}
 
 	go _arena.Run()
 
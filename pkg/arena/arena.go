@@ -5,12 +5,29 @@ import (
 	"fmt"
 	"log"
 	"strings"
+	"time"
 
+	"github.com/pion/interceptor/pkg/cc"
 	"github.com/pion/mediadevices"
 	"github.com/pion/mediadevices/pkg/prop"
 	"github.com/pion/webrtc/v3"
 
+	"github.com/roboportal/bot_box/pkg/audioout"
 	"github.com/roboportal/bot_box/pkg/bot"
+	"github.com/roboportal/bot_box/pkg/botcom"
+	"github.com/roboportal/bot_box/pkg/iceconfig"
+	"github.com/roboportal/bot_box/pkg/macro"
+	"github.com/roboportal/bot_box/pkg/micproc"
+	"github.com/roboportal/bot_box/pkg/netwatch"
+	"github.com/roboportal/bot_box/pkg/osd"
+	"github.com/roboportal/bot_box/pkg/peertrack"
+	"github.com/roboportal/bot_box/pkg/permissions"
+	"github.com/roboportal/bot_box/pkg/pipesink"
+	"github.com/roboportal/bot_box/pkg/pipesource"
+	"github.com/roboportal/bot_box/pkg/recorder"
+	"github.com/roboportal/bot_box/pkg/rtspserver"
+	"github.com/roboportal/bot_box/pkg/snapshot"
+	"github.com/roboportal/bot_box/pkg/synthetic"
 	"github.com/roboportal/bot_box/pkg/utils"
 	"github.com/roboportal/bot_box/pkg/cameraselector"
 )
@@ -24,19 +41,44 @@ type AnArena struct {
 	DisconnectChan                 chan struct{}
 	TokenString                    string
 	PublicKey                      string
-	stunURLs                       []string
+	iceConfig                      *iceconfig.AnICEConfig
+	iceRefreshTimer                *time.Timer
+	isPlatformICEServersEnabled    bool
+	iceNetwork                     ICENetworkParams
+	iceRestartGracePeriod          time.Duration
 	botsCount                      int
 	Bots                           []*bot.ABot
 	areControlsAllowedBySupervisor bool
-	videoCodecBitRate              int
+	videoCodecParams               VideoCodecParams
+	adaptiveBitRate                AdaptiveBitRateParams
+	isPerPeerEncodingEnabled       bool
+	cameras                        []CameraParams
+	videoSource                    string
+	pipeSource                     pipesource.Params
+	overlay                        *osd.AnOverlay
+	snapshot                       snapshot.Config
+	recording                      recorder.Config
+	broadcast                      BroadcastParams
+	rtsp                           rtspserver.Params
+	rtspCamera                     string
+	audioSource                    string
 	frameFormat                    string
 	videoWidth                     int
 	videoFrameRate                 int
 	areBotsReady                   bool
 	isAudioInputEnabled            bool
 	isAudioOutputEnabled           bool
+	audioOutput                    audioout.Config
+	soundClips                     audioout.ClipsConfig
+	audioSink                      pipesink.Params
+	audioProcessing                micproc.Config
 	CameraSelectChan							 chan string
 	cameraMultiplexerEnabled			 bool
+	isLocalControlActive           func(int) bool
+	macros                         macro.Config
+	tokenVerifier                  *permissions.Verifier
+	// robotModes are the last modes reported by the robots in the telemetry
+	robotModes map[int]string
 }
 
 type InitParams struct {
@@ -44,16 +86,195 @@ type InitParams struct {
 	TokenString string
 	PublicKey   string
 
-	VideoCodecBitRate int
-	FrameFormat       string
-	VideoWidth        int
-	VideoFrameRate    int
+	TurnUrls                    []string
+	TurnUsername                string
+	TurnCredential              string
+	ICETransportPolicy          string
+	IsPlatformICEServersEnabled bool
+	ICENetwork                  ICENetworkParams
+	// ICERestartGracePeriodSec is how long the lost connection is restored before the session is closed, 0 - disabled
+	ICERestartGracePeriodSec int
+
+	VideoCodecBitRate     int
+	VideoCodecs           []string
+	VideoKeyFrameInterval int
+	VPXRateControl        string
+	X264Preset            string
+	OpenH264RateControl   string
+	H264Profile           string
+	FrameFormat           string
+	Cameras               []CameraParams
+	VideoSource           string
+	PipeSource            pipesource.Params
+	Overlay               *osd.AnOverlay
+	Snapshot              snapshot.Config
+	Recording             recorder.Config
+	Broadcast             BroadcastParams
+	RTSP                  rtspserver.Params
+	// RTSPCamera is the name of the camera served over RTSP, the first camera is used when empty
+	RTSPCamera     string
+	VideoWidth     int
+	VideoFrameRate int
+
+	IsPerPeerEncodingEnabled    bool
+	IsAdaptiveBitRateEnabled    bool
+	VideoMinBitRate             int
+	VideoMaxBitRate             int
+	IsAdaptiveResolutionEnabled bool
+	IsAdaptiveFrameRateEnabled  bool
 
 	IsAudioInputEnabled  bool
 	IsAudioOutputEnabled bool
+	AudioSource          string
+	AudioOutput          audioout.Config
+	SoundClips           audioout.ClipsConfig
+	AudioPipe            pipesource.AudioParams
+	AudioSink            pipesink.Params
+	AudioProcessing      micproc.Config
+
+	TestPatternLabel string
+	ToneFrequency    float64
+
+	IsLocalControlActive func(int) bool
+
+	Macros macro.Config
+
+	TokenVerifier *permissions.Verifier
 }
 
 func Factory(p InitParams) AnArena {
+	if p.VideoSource != "" && p.VideoSource != CameraSource && p.VideoSource != synthetic.TestPatternLabel && p.VideoSource != pipesource.Label {
+		panic("video_source param has wrong value")
+	}
+
+	if p.AudioSource != "" && p.AudioSource != MicrophoneSource && p.AudioSource != synthetic.ToneLabel && p.AudioSource != pipesource.Label {
+		panic("audio_source param has wrong value")
+	}
+
+	isTestPatternUsed := p.VideoSource == synthetic.TestPatternLabel
+	isPipeUsed := p.VideoSource == pipesource.Label
+
+	for _, c := range p.Cameras {
+		isTestPatternUsed = isTestPatternUsed || c.Device == synthetic.TestPatternLabel
+		isPipeUsed = isPipeUsed || c.Device == pipesource.Label
+	}
+
+	if isTestPatternUsed {
+		synthetic.RegisterTestPattern(p.TestPatternLabel)
+	}
+
+	if isPipeUsed {
+		err := p.PipeSource.Validate()
+
+		if err != nil {
+			panic(err)
+		}
+
+		if p.PipeSource.IsEncoded() && len(p.Cameras) > 0 {
+			panic("encoded pipe video could be used only as video_source")
+		}
+
+		if !p.PipeSource.IsEncoded() {
+			pipesource.RegisterRaw(p.PipeSource)
+		}
+	}
+
+	if p.AudioSource == synthetic.ToneLabel {
+		synthetic.RegisterTone(p.ToneFrequency)
+	}
+
+	if p.AudioSource == pipesource.Label {
+		err := p.AudioPipe.Validate()
+
+		if err != nil {
+			panic(err)
+		}
+
+		pipesource.RegisterAudio(p.AudioPipe)
+	}
+
+	iceConfig, err := iceconfig.Factory(iceconfig.Params{
+		StunURLs:        p.StunUrls,
+		TurnURLs:        p.TurnUrls,
+		TurnUsername:    p.TurnUsername,
+		TurnCredential:  p.TurnCredential,
+		TransportPolicy: p.ICETransportPolicy,
+	})
+
+	if err != nil {
+		panic(err)
+	}
+
+	err = p.ICENetwork.Validate()
+
+	if err != nil {
+		panic(err)
+	}
+
+	minBitRate := p.VideoMinBitRate
+
+	if p.IsAdaptiveBitRateEnabled {
+		err = AdaptiveBitRateParams{MinBitRate: p.VideoMinBitRate, MaxBitRate: p.VideoMaxBitRate}.Validate()
+
+		if err != nil {
+			panic(err)
+		}
+	} else if minBitRate > p.VideoMaxBitRate {
+		// the default min bit rate could exceed a low codec bit rate, without adaptive bit rate the bounds
+		// only cap the fixed quality of the session
+		minBitRate = p.VideoMaxBitRate
+	}
+
+	err = p.Snapshot.Validate()
+
+	if err != nil {
+		panic(err)
+	}
+
+	err = p.Recording.Validate()
+
+	if err != nil {
+		panic(err)
+	}
+
+	err = p.Broadcast.Validate()
+
+	if err != nil {
+		panic(err)
+	}
+
+	err = p.RTSP.Validate()
+
+	if err != nil {
+		panic(err)
+	}
+
+	err = p.AudioProcessing.Validate()
+
+	if err != nil {
+		panic(err)
+	}
+
+	err = p.AudioSink.Validate()
+
+	if err != nil {
+		panic(err)
+	}
+
+	err = p.SoundClips.Validate()
+
+	if err != nil {
+		panic(err)
+	}
+
+	if p.IsAudioOutputEnabled || p.SoundClips.IsEnabled() {
+		err = p.AudioOutput.Validate()
+
+		if err != nil {
+			panic(err)
+		}
+	}
+
 	return AnArena{
 		WSReadChan:           make(chan string, 1000),
 		WSWriteChan:          make(chan string, 1000),
@@ -64,19 +285,59 @@ func Factory(p InitParams) AnArena {
 
 		TokenString: p.TokenString,
 		PublicKey:   p.PublicKey,
-		stunURLs:    p.StunUrls,
-
-		videoCodecBitRate: p.VideoCodecBitRate,
-		frameFormat:       p.FrameFormat,
-		videoWidth:        p.VideoWidth,
-		videoFrameRate:    p.VideoFrameRate,
+		iceConfig:   iceConfig,
+
+		isPlatformICEServersEnabled: p.IsPlatformICEServersEnabled,
+		iceNetwork:                  p.ICENetwork,
+		iceRestartGracePeriod:       time.Duration(p.ICERestartGracePeriodSec) * time.Second,
+
+		videoCodecParams: VideoCodecParams{
+			Codecs:              p.VideoCodecs,
+			BitRate:             p.VideoCodecBitRate,
+			KeyFrameInterval:    p.VideoKeyFrameInterval,
+			VPXRateControl:      p.VPXRateControl,
+			X264Preset:          p.X264Preset,
+			OpenH264RateControl: p.OpenH264RateControl,
+			H264Profile:         p.H264Profile,
+		},
+		adaptiveBitRate: AdaptiveBitRateParams{
+			IsEnabled:            p.IsAdaptiveBitRateEnabled,
+			MinBitRate:           minBitRate,
+			MaxBitRate:           p.VideoMaxBitRate,
+			IsAdaptiveResolution: p.IsAdaptiveResolutionEnabled,
+			IsAdaptiveFrameRate:  p.IsAdaptiveFrameRateEnabled,
+		},
+		isPerPeerEncodingEnabled: p.IsPerPeerEncodingEnabled || p.IsAdaptiveBitRateEnabled,
+
+		cameras:        p.Cameras,
+		videoSource:    p.VideoSource,
+		pipeSource:     p.PipeSource,
+		overlay:        p.Overlay,
+		snapshot:       p.Snapshot,
+		recording:      p.Recording,
+		broadcast:      p.Broadcast,
+		rtsp:           p.RTSP,
+		rtspCamera:     p.RTSPCamera,
+		frameFormat:    p.FrameFormat,
+		videoWidth:     p.VideoWidth,
+		videoFrameRate: p.VideoFrameRate,
 
 		isAudioInputEnabled:            p.IsAudioInputEnabled,
 		isAudioOutputEnabled:           p.IsAudioOutputEnabled,
+		audioSource:                    p.AudioSource,
+		audioOutput:                    p.AudioOutput,
+		soundClips:                     p.SoundClips,
+		audioSink:                      p.AudioSink,
+		audioProcessing:                p.AudioProcessing,
 		areControlsAllowedBySupervisor: true,
 		areBotsReady:                   false,
 
 		CameraSelectChan:        make(chan string, 1),
+
+		isLocalControlActive: p.IsLocalControlActive,
+		macros:               p.Macros,
+		tokenVerifier:        p.TokenVerifier,
+		robotModes:           make(map[int]string),
 	}
 }
 
@@ -105,6 +366,32 @@ func (a *AnArena) AreBotsReady() bool {
 	return true
 }
 
+// IsRemoteControlActive reports whether an operator is connected and ready to control the bot
+func (a *AnArena) IsRemoteControlActive(id int) bool {
+	if id < 0 || id >= len(a.Bots) || a.Bots[id] == nil {
+		return false
+	}
+
+	return a.Bots[id].Status == bot.Connected && a.Bots[id].IsReady
+}
+
+// AbortMacro stops the macro running on the bot, e.g. when the local controller takes over
+func (a *AnArena) AbortMacro(id int) {
+	if id < 0 || id >= len(a.Bots) || a.Bots[id] == nil {
+		return
+	}
+
+	a.Bots[id].AbortMacro()
+}
+
+func (a *AnArena) getIsLocalControlActive(id int) bool {
+	if a.isLocalControlActive == nil {
+		return false
+	}
+
+	return a.isLocalControlActive(id)
+}
+
 func (a *AnArena) disconnectAllBots() {
 	for _, b := range a.Bots {
 		b.SendDataChan <- "{\"type\": \"DISCONNECTED_BY_ADMIN\"}"
@@ -183,34 +470,109 @@ func (a *AnArena) Run() {
 			
 			a.botsCount = payload.NBots
 
+			synthetic.SetTestPatternBots(payload.NBots)
+
 			a.Bots = make([]*bot.ABot, payload.NBots)
 
 			break
 		}
 	}
 
-	codecSelector := getCodecSelector(a.videoCodecBitRate)
+	if a.isPlatformICEServersEnabled {
+		a.requestICEServers()
+	}
+
+	codecSelector := getCodecSelector(a.videoCodecParams)
+
+	// encoded pipe video is forwarded as is, bypassing the encoders of the codec selector
+	isPassthrough := a.videoSource == pipesource.Label && a.pipeSource.IsEncoded()
+	passthroughMimeType := ""
+
+	if isPassthrough {
+		passthroughMimeType = a.pipeSource.MimeType()
+	}
 
 	mediaEngine := webrtc.MediaEngine{}
-	codecSelector.Populate(&mediaEngine)
 
-	settingEngine := webrtc.SettingEngine{}
+	err := populateMediaEngine(&mediaEngine, codecSelector, passthroughMimeType)
+
+	if err != nil {
+		log.Println("Populate media engine error", err)
+		panic(err)
+	}
+
+	settingEngine, err := buildSettingEngine(a.iceNetwork)
+
+	if err != nil {
+		log.Println("Build setting engine error", err)
+		panic(err)
+	}
+
+	var networkWatcher *netwatch.AWatcher
+
+	if a.iceRestartGracePeriod > 0 {
+		networkWatcher = netwatch.Factory(networkWatchInterval, a.iceNetwork.isInterfaceAllowed)
+	}
+
+	audioDeviceID := findSourceDeviceID(mediadevices.AudioInput, a.audioSource, synthetic.ToneLabel)
+
+	if audioDeviceID == "" {
+		audioDeviceID = findSourceDeviceID(mediadevices.AudioInput, a.audioSource, pipesource.Label)
+	}
 
 	audioConstraints := func(c *mediadevices.MediaTrackConstraints) {
 		c.ChannelCount = prop.Int(1)
+
+		if audioDeviceID != "" {
+			c.DeviceID = prop.StringExact(audioDeviceID)
+		}
 	}
 
 	if !a.isAudioInputEnabled {
 		audioConstraints = nil
 	}
 
-	mediaStream, err := mediadevices.GetUserMedia(mediadevices.MediaStreamConstraints{
-		Video: func(c *mediadevices.MediaTrackConstraints) {
-			c.FrameFormat = prop.FrameFormat(a.frameFormat)
-			c.Width = prop.Int(a.videoWidth)
-			c.FrameRate = prop.Float(a.videoFrameRate)
+	if a.isAudioOutputEnabled || a.soundClips.IsEnabled() {
+		err := audioout.Init(a.audioOutput)
 
-		},
+		if err != nil {
+			log.Println("Open audio output error", err)
+			panic(err)
+		}
+	}
+
+	if a.soundClips.IsEnabled() {
+		err := audioout.LoadClips(a.soundClips)
+
+		if err != nil {
+			log.Println("Load sound clips error", err)
+			panic(err)
+		}
+	}
+
+	videoDeviceID := findSourceDeviceID(mediadevices.VideoInput, a.videoSource, synthetic.TestPatternLabel)
+
+	if videoDeviceID == "" {
+		videoDeviceID = findSourceDeviceID(mediadevices.VideoInput, a.videoSource, pipesource.Label)
+	}
+
+	videoConstraints := func(c *mediadevices.MediaTrackConstraints) {
+		c.FrameFormat = prop.FrameFormat(a.frameFormat)
+		c.Width = prop.Int(a.videoWidth)
+		c.FrameRate = prop.Float(a.videoFrameRate)
+
+		if videoDeviceID != "" {
+			c.DeviceID = prop.StringExact(videoDeviceID)
+		}
+	}
+
+	// configured cameras are opened one by one to get a track per device
+	if len(a.cameras) > 0 || isPassthrough {
+		videoConstraints = nil
+	}
+
+	mediaStream, err := mediadevices.GetUserMedia(mediadevices.MediaStreamConstraints{
+		Video: videoConstraints,
 		Audio: audioConstraints,
 		Codec: codecSelector,
 	})
@@ -220,18 +582,112 @@ func (a *AnArena) Run() {
 		panic(err)
 	}
 
+	var audioProcessor *micproc.AProcessor
+
+	if a.isAudioInputEnabled {
+		audioProcessor = micproc.Factory(a.audioProcessing)
+
+		for _, t := range mediaStream.GetAudioTracks() {
+			if track, ok := t.(*mediadevices.AudioTrack); ok {
+				track.Transform(audioProcessor.Transform())
+			}
+		}
+	}
+
+	cameras := make([]botcom.Camera, 0)
+
+	for _, track := range mediaStream.GetVideoTracks() {
+		cameras = append(cameras, botcom.Camera{Name: track.ID(), Track: track})
+	}
+
+	if len(a.cameras) > 0 {
+		cameras, err = a.openCameras(codecSelector)
+
+		if err != nil {
+			log.Println("Open cameras error", err)
+			panic(err)
+		}
+	}
+
+	if a.overlay != nil {
+		for _, c := range cameras {
+			if track, ok := c.Track.(*mediadevices.VideoTrack); ok {
+				log.Println("Enabling telemetry overlay for:", c.Name)
+				track.Transform(a.overlay.Transform())
+			}
+		}
+	}
+
+	if isPassthrough {
+		track, err := pipesource.NewEncodedTrack(a.pipeSource, pipesource.Label)
+
+		if err != nil {
+			log.Println("Create pipe video track error", err)
+			panic(err)
+		}
+
+		cameras = append(cameras, botcom.Camera{Name: pipesource.Label, Track: track})
+	}
+
 	api := webrtc.NewAPI(webrtc.WithMediaEngine(&mediaEngine), webrtc.WithSettingEngine(settingEngine))
 
+	a.startBroadcast(api, cameras, mediaStream)
+	a.startRTSP(cameras)
+
+	var audioSink *pipesink.ASink
+
+	if a.audioSink.IsEnabled() {
+		audioSink = pipesink.Start(a.audioSink)
+	}
+
 	for index := 0; index < a.botsCount; index++ {
 		b := bot.Factory(index)
 		a.Bots[index] = &b
 
+		botAPI := api
+		var videoTrackConfig *peertrack.Config
+		var estimatorChan chan cc.BandwidthEstimator
+		var tapChan chan *recorder.Tap
+		var reportRTT func(int, time.Duration)
+
+		if a.overlay != nil {
+			reportRTT = a.overlay.SetRTT
+		}
+
+		if a.adaptiveBitRate.IsEnabled || a.recording.IsEnabled {
+			botAPI, estimatorChan, tapChan, err = buildBotAPI(
+				codecSelector,
+				passthroughMimeType,
+				settingEngine,
+				a.videoCodecParams.BitRate,
+				a.adaptiveBitRate,
+				a.recording.IsEnabled,
+			)
+
+			if err != nil {
+				log.Println("Build bot API error", err)
+				panic(err)
+			}
+		}
+
+		if a.isPerPeerEncodingEnabled {
+			videoTrackConfig = &peertrack.Config{
+				NewEncoder:           getVideoEncoderFactory(a.videoCodecParams),
+				InitialBitRate:       a.videoCodecParams.BitRate,
+				MinBitRate:           a.adaptiveBitRate.MinBitRate,
+				MaxBitRate:           a.adaptiveBitRate.MaxBitRate,
+				IsAdaptiveResolution: a.adaptiveBitRate.IsAdaptiveResolution,
+				IsAdaptiveFrameRate:  a.adaptiveBitRate.IsAdaptiveFrameRate,
+			}
+		}
+
 		botParams := bot.RunParams{
-			StunUrls:                          a.stunURLs,
+			GetICEConfiguration:               a.iceConfig.Configuration,
 			TokenString:                       a.TokenString,
 			PublicKey:                         a.PublicKey,
-			Api:                               api,
+			Api:                               botAPI,
 			MediaStream:                       mediaStream,
+			Cameras:                           cameras,
 			WsWriteChan:                       a.WSWriteChan,
 			BotCommandsWriteChan:              a.BotCommandsWriteChan,
 			GetAreControlsAllowedBySupervisor: a.getAreControlsAllowedBySupervisor,
@@ -240,7 +696,23 @@ func (a *AnArena) Run() {
 			SetBotNotReady:                    a.SetBotNotReady,
 			IsAudioOutputEnabled:              a.isAudioOutputEnabled,
 			CameraSelectChan:									 a.CameraSelectChan,
+			GetIsLocalControlActive:           a.getIsLocalControlActive,
+			Macros:                            a.macros,
+			VideoTrackConfig:                  videoTrackConfig,
+			EstimatorChan:                     estimatorChan,
+			ReportRTT:                         reportRTT,
+			Snapshot:                          a.snapshot,
+			Recording:                         a.recording,
+			TapChan:                           tapChan,
+			ICERestartGracePeriod:             a.iceRestartGracePeriod,
+			AudioSink:                         audioSink,
+			AudioProcessor:                    audioProcessor,
 		}
+
+		if networkWatcher != nil {
+			botParams.NetworkChangeChan = networkWatcher.Subscribe()
+		}
+
 		go b.Run(botParams)
 	}
 
@@ -273,6 +745,11 @@ func (a *AnArena) Run() {
 				panic("Restart")
 			}
 
+			if data.Action == "ICE_SERVERS" {
+				a.handleICEServers(data.Data)
+				continue
+			}
+
 			if data.Action == "DISCONNECT_ALL" {
 				a.disconnectAllBots()
 			}
@@ -305,6 +782,22 @@ func (a *AnArena) Run() {
 			b := a.Bots[data.ID]
 
 			if data.Action == "SET_DESCRIPTION" {
+				// the answer to the ICE restart offer of the established session
+				if b.Status != bot.Idle && b.ConnectionID == data.ConnectionID {
+					var d webrtc.SessionDescription
+					err := json.Unmarshal([]byte(data.Data), &d)
+
+					if err != nil || d.Type != webrtc.SDPTypeAnswer {
+						log.Println("Unexpected 'SET_DESCRIPTION' message for bot:", b.ID, err)
+						continue
+					}
+
+					log.Println("Set restart answer for bot: ", b.ID)
+
+					b.DescriptionChan <- d
+					continue
+				}
+
 				if b.ConnectionID == "" {
 					b.ConnectionID = data.ConnectionID
 				}
@@ -319,11 +812,61 @@ func (a *AnArena) Run() {
 					continue
 				}
 
+				type aDescriptionPayload struct {
+					OperatorToken string `json:"operatorToken"`
+				}
+
+				var payload aDescriptionPayload
+				err := json.Unmarshal([]byte(data.Data), &payload)
+
+				if err != nil {
+					log.Println("Parse 'SET_DESCRIPTION' message from RoboPortal error", err)
+					continue
+				}
+
+				claims, err := a.tokenVerifier.Verify(payload.OperatorToken)
+
+				if err != nil {
+					log.Println("Operator token rejected for bot:", b.ID, err)
+					b.ClearConnectionID()
+
+					// the client is told the bot is released, so it stops waiting for the answer
+					type UnblockRejectedPayload struct {
+						Token     string `json:"token"`
+						PublicKey string `json:"publicKey"`
+						ID        int    `json:"id"`
+					}
+
+					type UnblockRejectedAction struct {
+						Name    string                 `json:"name"`
+						Payload UnblockRejectedPayload `json:"payload"`
+					}
+
+					message, err := json.Marshal(UnblockRejectedAction{
+						Name: "UNBLOCK_DISCONNECTED",
+						Payload: UnblockRejectedPayload{
+							Token:     a.TokenString,
+							PublicKey: a.PublicKey,
+							ID:        b.ID,
+						},
+					})
+
+					if err != nil {
+						log.Println("Serialize 'UNBLOCK_DISCONNECTED' message to RoboPortal error", err)
+						continue
+					}
+
+					a.WSWriteChan <- string(message)
+					continue
+				}
+
+				b.SetPermissions(claims)
+
 				b.SetConnecting()
 				log.Println("Set description for bot: ", b.ID)
 
 				var d webrtc.SessionDescription
-				err := json.Unmarshal([]byte(data.Data), &d)
+				err = json.Unmarshal([]byte(data.Data), &d)
 
 				if err != nil {
 					log.Println("Parse 'SET_DESCRIPTION' message from RoboPortal error", err)
@@ -340,7 +883,8 @@ func (a *AnArena) Run() {
 					continue
 				}
 
-				if b.Status != bot.Connecting {
+				// the candidates of ICE restart come while the bot is still connected, e.g. on network change
+				if b.Status == bot.Idle {
 					log.Println("Bot is not connecting when set candidate:", b.ID)
 					continue
 				}
@@ -409,7 +953,8 @@ func (a *AnArena) Run() {
 			sanitizedMsg := r.Replace(serialMsg)
 
 			type TelemetryMessage struct {
-				ID int `json:"id"`
+				ID   int    `json:"id"`
+				Mode string `json:"mode"`
 			}
 
 			var t TelemetryMessage
@@ -421,6 +966,28 @@ func (a *AnArena) Run() {
 				continue
 			}
 
+			a.Bots[t.ID].SetTelemetry(sanitizedMsg)
+
+			if a.overlay != nil {
+				var data map[string]interface{}
+
+				if json.Unmarshal([]byte(sanitizedMsg), &data) == nil {
+					a.overlay.SetTelemetry(t.ID, data)
+				}
+			}
+
+			// the robot could report its current mode in every message, only a change is a request,
+			// so the mode set by the operator is not undone by the next telemetry
+			if t.Mode != "" && t.Mode != a.robotModes[t.ID] {
+				a.robotModes[t.ID] = t.Mode
+
+				if botcom.IsValidMode(t.Mode) {
+					a.Bots[t.ID].ModeChan <- botcom.ModeChange{Mode: t.Mode, Source: botcom.ModeSourceRobot}
+				} else {
+					log.Println("Unknown mode requested by robot:", t.Mode)
+				}
+			}
+
 			if a.Bots[t.ID].Status == bot.Connected {
 				telemetry := fmt.Sprintf("{\"type\": \"TELEMETRY\", \"payload\": %s}", sanitizedMsg)
 				a.Bots[t.ID].SendDataChan <- telemetry
@@ -0,0 +1,83 @@
+package arena
+
+import (
+	"fmt"
+
+	"github.com/pion/interceptor"
+	"github.com/pion/interceptor/pkg/cc"
+	"github.com/pion/interceptor/pkg/gcc"
+	"github.com/pion/webrtc/v3"
+)
+
+type AdaptiveBitRateParams struct {
+	IsEnabled            bool
+	MinBitRate           int
+	MaxBitRate           int
+	IsAdaptiveResolution bool
+	IsAdaptiveFrameRate  bool
+}
+
+func (p AdaptiveBitRateParams) Validate() error {
+	if p.MinBitRate <= 0 {
+		return fmt.Errorf("video min bit rate should be positive: %d", p.MinBitRate)
+	}
+
+	if p.MaxBitRate < p.MinBitRate {
+		return fmt.Errorf("video max bit rate should not be less than min bit rate: %d < %d", p.MaxBitRate, p.MinBitRate)
+	}
+
+	return nil
+}
+
+// registerAdaptiveBitRate adds congestion control interceptors to the API of a single bot.
+// The estimator of every new peer connection is pushed to the returned channel,
+// it happens synchronously inside NewPeerConnection, so the bot could pick it right after the call.
+func registerAdaptiveBitRate(
+	mediaEngine *webrtc.MediaEngine,
+	interceptorRegistry *interceptor.Registry,
+	initialBitRate int,
+	p AdaptiveBitRateParams,
+) (chan cc.BandwidthEstimator, error) {
+	err := webrtc.RegisterDefaultInterceptors(mediaEngine, interceptorRegistry)
+
+	if err != nil {
+		return nil, err
+	}
+
+	mediaEngine.RegisterFeedback(webrtc.RTCPFeedback{Type: "ccm", Parameter: "fir"}, webrtc.RTPCodecTypeVideo)
+	mediaEngine.RegisterFeedback(webrtc.RTCPFeedback{Type: webrtc.TypeRTCPFBGoogREMB}, webrtc.RTPCodecTypeVideo)
+
+	err = webrtc.ConfigureTWCCHeaderExtensionSender(mediaEngine, interceptorRegistry)
+
+	if err != nil {
+		return nil, err
+	}
+
+	congestionController, err := cc.NewInterceptor(func() (cc.BandwidthEstimator, error) {
+		return gcc.NewSendSideBWE(
+			gcc.SendSideBWEInitialBitrate(initialBitRate),
+			gcc.SendSideBWEMinBitrate(p.MinBitRate),
+			gcc.SendSideBWEMaxBitrate(p.MaxBitRate),
+		)
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	estimatorChan := make(chan cc.BandwidthEstimator, 1)
+
+	congestionController.OnNewPeerConnection(func(id string, estimator cc.BandwidthEstimator) {
+		// drop the estimator of a connection which was never picked up
+		select {
+		case <-estimatorChan:
+		default:
+		}
+
+		estimatorChan <- estimator
+	})
+
+	interceptorRegistry.Add(congestionController)
+
+	return estimatorChan, nil
+}
@@ -0,0 +1,56 @@
+package arena
+
+import (
+	"github.com/pion/interceptor"
+	"github.com/pion/interceptor/pkg/cc"
+	"github.com/pion/mediadevices"
+	"github.com/pion/webrtc/v3"
+	"github.com/roboportal/bot_box/pkg/recorder"
+)
+
+// buildBotAPI creates the API with own interceptors for a single bot, the channels are nil for disabled features
+func buildBotAPI(
+	codecSelector *mediadevices.CodecSelector,
+	passthroughMimeType string,
+	settingEngine webrtc.SettingEngine,
+	initialBitRate int,
+	adaptiveBitRate AdaptiveBitRateParams,
+	isRecordingEnabled bool,
+) (*webrtc.API, chan cc.BandwidthEstimator, chan *recorder.Tap, error) {
+	mediaEngine := webrtc.MediaEngine{}
+
+	err := populateMediaEngine(&mediaEngine, codecSelector, passthroughMimeType)
+
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	interceptorRegistry := &interceptor.Registry{}
+
+	var estimatorChan chan cc.BandwidthEstimator
+	var tapChan chan *recorder.Tap
+
+	if adaptiveBitRate.IsEnabled {
+		estimatorChan, err = registerAdaptiveBitRate(&mediaEngine, interceptorRegistry, initialBitRate, adaptiveBitRate)
+
+		if err != nil {
+			return nil, nil, nil, err
+		}
+	}
+
+	// the tap goes last to see the packets as they are written by the tracks, before retransmissions
+	if isRecordingEnabled {
+		var tapFactory *recorder.TapFactory
+
+		tapFactory, tapChan = recorder.NewTapFactory()
+		interceptorRegistry.Add(tapFactory)
+	}
+
+	api := webrtc.NewAPI(
+		webrtc.WithMediaEngine(&mediaEngine),
+		webrtc.WithSettingEngine(settingEngine),
+		webrtc.WithInterceptorRegistry(interceptorRegistry),
+	)
+
+	return api, estimatorChan, tapChan, nil
+}
@@ -0,0 +1,82 @@
+package arena
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/pion/mediadevices"
+	"github.com/pion/webrtc/v3"
+
+	"github.com/roboportal/bot_box/pkg/botcom"
+	"github.com/roboportal/bot_box/pkg/broadcast"
+)
+
+type BroadcastParams struct {
+	WHIP broadcast.WHIPParams
+	WHEP broadcast.WHEPParams
+	// Camera is the name of the broadcast camera, the first camera is used when empty
+	Camera string
+}
+
+func (p BroadcastParams) isEnabled() bool {
+	return p.WHIP.URL != "" || p.WHEP.Address != ""
+}
+
+func (p BroadcastParams) Validate() error {
+	err := p.WHIP.Validate()
+
+	if err != nil {
+		return err
+	}
+
+	return p.WHEP.Validate()
+}
+
+func findBroadcastTrack(cameras []botcom.Camera, name string) (webrtc.TrackLocal, error) {
+	for _, camera := range cameras {
+		if name == "" || camera.Name == name {
+			return camera.Track, nil
+		}
+	}
+
+	return nil, fmt.Errorf("unknown broadcast camera: %s", name)
+}
+
+// startBroadcast publishes the camera and the audio of the robot with WHIP and WHEP besides the RoboPortal sessions
+func (a *AnArena) startBroadcast(api *webrtc.API, cameras []botcom.Camera, mediaStream mediadevices.MediaStream) {
+	if !a.broadcast.isEnabled() {
+		return
+	}
+
+	tracks := make([]webrtc.TrackLocal, 0)
+
+	if len(cameras) > 0 {
+		track, err := findBroadcastTrack(cameras, a.broadcast.Camera)
+
+		if err != nil {
+			log.Println("Start broadcast error", err)
+			panic(err)
+		}
+
+		tracks = append(tracks, track)
+	}
+
+	for _, track := range mediaStream.GetAudioTracks() {
+		tracks = append(tracks, track)
+	}
+
+	source := broadcast.Source{
+		Api:              api,
+		GetConfiguration: a.iceConfig.Configuration,
+		Tracks:           tracks,
+	}
+
+	if a.broadcast.WHIP.URL != "" {
+		log.Println("Publishing with WHIP to:", a.broadcast.WHIP.URL)
+		broadcast.Publish(source, a.broadcast.WHIP)
+	}
+
+	if a.broadcast.WHEP.Address != "" {
+		broadcast.Serve(source, a.broadcast.WHEP)
+	}
+}
@@ -0,0 +1,123 @@
+package arena
+
+import (
+	"fmt"
+	"log"
+	"path/filepath"
+	"strings"
+
+	"github.com/pion/mediadevices"
+	"github.com/pion/mediadevices/pkg/driver/camera"
+	"github.com/pion/mediadevices/pkg/prop"
+
+	"github.com/roboportal/bot_box/pkg/botcom"
+)
+
+const (
+	CameraSource     = "camera"
+	MicrophoneSource = "microphone"
+)
+
+type CameraParams struct {
+	Name string
+	// Device is matched against the device ID or any part of its label, e.g. 'video0' or '/dev/v4l/by-path/...'
+	Device string
+}
+
+// ParseCameras parses 'name=device' entries of the camera list
+func ParseCameras(entries []string) ([]CameraParams, error) {
+	cameras := make([]CameraParams, 0, len(entries))
+	names := make(map[string]bool)
+
+	for _, entry := range entries {
+		parts := strings.SplitN(entry, "=", 2)
+
+		if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" || strings.TrimSpace(parts[1]) == "" {
+			return nil, fmt.Errorf("camera entry should be in 'name=device' format: %s", entry)
+		}
+
+		name := strings.TrimSpace(parts[0])
+
+		if names[name] {
+			return nil, fmt.Errorf("duplicated camera name: %s", name)
+		}
+
+		names[name] = true
+
+		cameras = append(cameras, CameraParams{Name: name, Device: strings.TrimSpace(parts[1])})
+	}
+
+	return cameras, nil
+}
+
+func findDeviceID(kind mediadevices.MediaDeviceType, device string) (string, error) {
+	base := filepath.Base(device)
+
+	for _, info := range mediadevices.EnumerateDevices() {
+		if info.Kind != kind {
+			continue
+		}
+
+		if info.DeviceID == device {
+			return info.DeviceID, nil
+		}
+
+		for _, label := range strings.Split(info.Label, camera.LabelSeparator) {
+			if label == device || label == base {
+				return info.DeviceID, nil
+			}
+		}
+	}
+
+	return "", fmt.Errorf("media device not found: %s", device)
+}
+
+// findSourceDeviceID returns the device ID of the non-hardware source when it is selected, empty string otherwise
+func findSourceDeviceID(kind mediadevices.MediaDeviceType, source string, label string) string {
+	if source != label {
+		return ""
+	}
+
+	deviceID, err := findDeviceID(kind, label)
+
+	if err != nil {
+		panic(err)
+	}
+
+	return deviceID
+}
+
+// openCameras opens every configured camera as a separate video track
+func (a *AnArena) openCameras(codecSelector *mediadevices.CodecSelector) ([]botcom.Camera, error) {
+	cameras := make([]botcom.Camera, 0, len(a.cameras))
+
+	for _, c := range a.cameras {
+		deviceID, err := findDeviceID(mediadevices.VideoInput, c.Device)
+
+		if err != nil {
+			return nil, err
+		}
+
+		log.Println("Opening camera:", c.Name, c.Device, deviceID)
+
+		stream, err := mediadevices.GetUserMedia(mediadevices.MediaStreamConstraints{
+			Video: func(constraints *mediadevices.MediaTrackConstraints) {
+				constraints.DeviceID = prop.StringExact(deviceID)
+				constraints.FrameFormat = prop.FrameFormat(a.frameFormat)
+				constraints.Width = prop.Int(a.videoWidth)
+				constraints.FrameRate = prop.Float(a.videoFrameRate)
+			},
+			Codec: codecSelector,
+		})
+
+		if err != nil {
+			return nil, fmt.Errorf("open camera %s error: %w", c.Name, err)
+		}
+
+		for _, track := range stream.GetVideoTracks() {
+			cameras = append(cameras, botcom.Camera{Name: c.Name, Track: track})
+		}
+	}
+
+	return cameras, nil
+}
@@ -0,0 +1,49 @@
+//go:build openh264
+// +build openh264
+
+package arena
+
+import (
+	"fmt"
+
+	"github.com/pion/mediadevices/pkg/codec"
+	"github.com/pion/mediadevices/pkg/codec/openh264"
+)
+
+var openh264RateControlModes = map[string]openh264.RCModeEnum{
+	"quality":   openh264.RCQualityMode,
+	"bitrate":   openh264.RCBitrateMode,
+	"buffer":    openh264.RCBufferbaseedMode,
+	"timestamp": openh264.RCTimestampMode,
+	"off":       openh264.RCOffMode,
+}
+
+func init() {
+	videoEncoderFactories["openh264"] = newOpenH264Params
+}
+
+func newOpenH264Params(p VideoCodecParams) (codec.VideoEncoderBuilder, error) {
+	openh264Params, err := openh264.NewParams()
+
+	if err != nil {
+		return nil, err
+	}
+
+	openh264Params.BitRate = p.BitRate
+
+	if p.KeyFrameInterval > 0 {
+		openh264Params.IntraPeriod = uint(p.KeyFrameInterval)
+	}
+
+	if p.OpenH264RateControl != "" {
+		mode, ok := openh264RateControlModes[p.OpenH264RateControl]
+
+		if !ok {
+			return nil, fmt.Errorf("unknown openh264 rate control mode: %s", p.OpenH264RateControl)
+		}
+
+		openh264Params.RCMode = mode
+	}
+
+	return &openh264Params, nil
+}
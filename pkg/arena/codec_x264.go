@@ -0,0 +1,66 @@
+//go:build x264
+// +build x264
+
+package arena
+
+import (
+	"fmt"
+
+	"github.com/pion/mediadevices/pkg/codec"
+	"github.com/pion/mediadevices/pkg/codec/x264"
+)
+
+var x264Presets = map[string]x264.Preset{
+	"ultrafast": x264.PresetUltrafast,
+	"superfast": x264.PresetSuperfast,
+	"veryfast":  x264.PresetVeryfast,
+	"faster":    x264.PresetFaster,
+	"fast":      x264.PresetFast,
+	"medium":    x264.PresetMedium,
+	"slow":      x264.PresetSlow,
+	"slower":    x264.PresetSlower,
+	"veryslow":  x264.PresetVeryslow,
+}
+
+func init() {
+	videoEncoderFactories["x264"] = newX264Params
+}
+
+// anX264Params advertises the profile x264 encodes, mediadevices offers every H.264 encoder as constrained baseline
+type anX264Params struct {
+	x264.Params
+}
+
+func (p *anX264Params) RTPCodec() *codec.RTPCodec {
+	rtpCodec := p.Params.RTPCodec()
+	rtpCodec.SDPFmtpLine = h264ProfileFmtpLines[H264ProfileHigh]
+
+	return rtpCodec
+}
+
+func newX264Params(p VideoCodecParams) (codec.VideoEncoderBuilder, error) {
+	x264Params, err := x264.NewParams()
+
+	if err != nil {
+		return nil, err
+	}
+
+	x264Params.BitRate = p.BitRate
+	x264Params.Preset = x264.PresetUltrafast
+
+	if p.KeyFrameInterval > 0 {
+		x264Params.KeyFrameInterval = p.KeyFrameInterval
+	}
+
+	if p.X264Preset != "" {
+		preset, ok := x264Presets[p.X264Preset]
+
+		if !ok {
+			return nil, fmt.Errorf("unknown x264 preset: %s", p.X264Preset)
+		}
+
+		x264Params.Preset = preset
+	}
+
+	return &anX264Params{Params: x264Params}, nil
+}
@@ -1,26 +1,200 @@
-//go:build !arm
-// +build !arm
-
 package arena
 
 import (
+	"fmt"
+	"log"
+	"strings"
+
 	"github.com/pion/mediadevices"
+	"github.com/pion/mediadevices/pkg/codec"
 	"github.com/pion/mediadevices/pkg/codec/opus"
 	"github.com/pion/mediadevices/pkg/codec/vpx"
+	"github.com/pion/webrtc/v3"
 
 	_ "github.com/pion/mediadevices/pkg/driver/camera"
 	_ "github.com/pion/mediadevices/pkg/driver/microphone"
+
+	"github.com/roboportal/bot_box/pkg/peertrack"
 )
 
-func getCodecSelector(bitRate int) *mediadevices.CodecSelector {
+type VideoCodecParams struct {
+	// Codecs in the order of preference: vp8, vp9, h264, x264, openh264
+	Codecs           []string
+	BitRate          int
+	KeyFrameInterval int
+	// VPXRateControl is one of vbr, cbr, cq
+	VPXRateControl string
+	// X264Preset is one of ultrafast, superfast, veryfast, faster, fast, medium, slow, slower, veryslow
+	X264Preset string
+	// OpenH264RateControl is one of bitrate, quality, buffer, timestamp, off
+	OpenH264RateControl string
+	// H264Profile is one of constrained_baseline, high, the encoder producing it is picked for 'h264' codec name
+	H264Profile string
+}
+
+const (
+	// H264ProfileConstrainedBaseline is encoded by openh264, it is decoded by the most hardware decoders
+	H264ProfileConstrainedBaseline = "constrained_baseline"
+	// H264ProfileHigh is encoded by x264
+	H264ProfileHigh = "high"
+)
+
+// h264EncoderProfiles are the profiles the encoders produce, mediadevices does not pass a profile to them:
+// x264 bridge always applies 'high' and openh264 encodes only constrained baseline
+var h264EncoderProfiles = map[string]string{
+	"x264":     H264ProfileHigh,
+	"openh264": H264ProfileConstrainedBaseline,
+}
+
+// h264ProfileFmtpLines advertise the profile the encoder produces, so the peers without its support negotiate
+// another codec, level 3.1 is the default of mediadevices
+var h264ProfileFmtpLines = map[string]string{
+	H264ProfileConstrainedBaseline: "level-asymmetry-allowed=1;packetization-mode=1;profile-level-id=42e01f",
+	H264ProfileHigh:                "level-asymmetry-allowed=1;packetization-mode=1;profile-level-id=64001f",
+}
+
+type videoEncoderFactory func(p VideoCodecParams) (codec.VideoEncoderBuilder, error)
+
+// videoEncoderFactories is extended by the files with build tags for the codecs requiring extra libraries
+var videoEncoderFactories = map[string]videoEncoderFactory{
+	"vp8": newVP8Params,
+	"vp9": newVP9Params,
+}
+
+// h264Encoders are tried in order for 'h264' codec name
+var h264Encoders = []string{"x264", "openh264"}
+
+var vpxRateControlModes = map[string]vpx.RateControlMode{
+	"vbr": vpx.RateControlVBR,
+	"cbr": vpx.RateControlCBR,
+	"cq":  vpx.RateControlCQ,
+}
+
+func applyVPXParams(params *vpx.Params, p VideoCodecParams) error {
+	params.BitRate = p.BitRate
+
+	if p.KeyFrameInterval > 0 {
+		params.KeyFrameInterval = p.KeyFrameInterval
+	}
+
+	if p.VPXRateControl != "" {
+		mode, ok := vpxRateControlModes[p.VPXRateControl]
+
+		if !ok {
+			return fmt.Errorf("unknown VP8/VP9 rate control mode: %s", p.VPXRateControl)
+		}
+
+		params.RateControlEndUsage = mode
+	}
+
+	return nil
+}
+
+func newVP8Params(p VideoCodecParams) (codec.VideoEncoderBuilder, error) {
 	vpxParams, err := vpx.NewVP8Params()
 
 	if err != nil {
-		panic(err)
+		return nil, err
+	}
+
+	err = applyVPXParams(&vpxParams.Params, p)
+
+	return &vpxParams, err
+}
+
+func newVP9Params(p VideoCodecParams) (codec.VideoEncoderBuilder, error) {
+	vpxParams, err := vpx.NewVP9Params()
+
+	if err != nil {
+		return nil, err
+	}
+
+	err = applyVPXParams(&vpxParams.Params, p)
+
+	return &vpxParams, err
+}
+
+func resolveVideoCodecName(name string, profile string) (string, error) {
+	name = strings.ToLower(name)
+
+	if _, ok := h264ProfileFmtpLines[profile]; profile != "" && !ok {
+		return "", fmt.Errorf("unknown H.264 profile: %s", profile)
+	}
+
+	if name != "h264" {
+		if _, ok := videoEncoderFactories[name]; !ok {
+			return "", fmt.Errorf("video codec %s is not available, check build tags", name)
+		}
+
+		if encoderProfile, ok := h264EncoderProfiles[name]; ok && profile != "" && encoderProfile != profile {
+			return "", fmt.Errorf("video codec %s encodes only H.264 %s profile, not %s", name, encoderProfile, profile)
+		}
+
+		return name, nil
 	}
 
-	vpxParams.BitRate = bitRate
+	for _, encoder := range h264Encoders {
+		if profile != "" && h264EncoderProfiles[encoder] != profile {
+			continue
+		}
 
+		if _, ok := videoEncoderFactories[encoder]; ok {
+			return encoder, nil
+		}
+	}
+
+	if profile != "" {
+		return "", fmt.Errorf("no H.264 encoder of %s profile available, check build tags", profile)
+	}
+
+	return "", fmt.Errorf("no H.264 encoder available, build with -tags=x264 or -tags=openh264")
+}
+
+func getVideoCodecNames(p VideoCodecParams) []string {
+	if len(p.Codecs) == 0 {
+		return []string{"vp8"}
+	}
+
+	return p.Codecs
+}
+
+func getVideoEncoders(p VideoCodecParams) []codec.VideoEncoderBuilder {
+	codecs := getVideoCodecNames(p)
+
+	encoders := make([]codec.VideoEncoderBuilder, 0, len(codecs))
+	mimeTypes := make(map[string]bool)
+
+	for _, name := range codecs {
+		resolved, err := resolveVideoCodecName(name, p.H264Profile)
+
+		if err != nil {
+			panic(err)
+		}
+
+		encoder, err := videoEncoderFactories[resolved](p)
+
+		if err != nil {
+			panic(err)
+		}
+
+		mimeType := encoder.RTPCodec().MimeType
+
+		if mimeTypes[mimeType] {
+			log.Println("Skipping video codec with already registered mime type:", resolved, mimeType)
+			continue
+		}
+
+		mimeTypes[mimeType] = true
+
+		log.Println("Registering video codec:", resolved, mimeType)
+
+		encoders = append(encoders, encoder)
+	}
+
+	return encoders
+}
+
+func getCodecSelector(p VideoCodecParams) *mediadevices.CodecSelector {
 	opusParams, err := opus.NewParams()
 
 	if err != nil {
@@ -28,9 +202,75 @@ func getCodecSelector(bitRate int) *mediadevices.CodecSelector {
 	}
 
 	codecSelector := mediadevices.NewCodecSelector(
-		mediadevices.WithVideoEncoders(&vpxParams),
+		mediadevices.WithVideoEncoders(getVideoEncoders(p)...),
 		mediadevices.WithAudioEncoders(&opusParams),
 	)
 
 	return codecSelector
 }
+
+// getVideoEncoderFactory builds encoder params for per-peer tracks, which pick the codec negotiated with the peer
+// and override the bitrate
+func getVideoEncoderFactory(p VideoCodecParams) peertrack.EncoderFactory {
+	return func(mimeType string, bitRate int) (codec.VideoEncoderBuilder, error) {
+		params := p
+		params.BitRate = bitRate
+
+		for _, name := range getVideoCodecNames(params) {
+			resolved, err := resolveVideoCodecName(name, params.H264Profile)
+
+			if err != nil {
+				return nil, err
+			}
+
+			encoder, err := videoEncoderFactories[resolved](params)
+
+			if err != nil {
+				return nil, err
+			}
+
+			if strings.EqualFold(encoder.RTPCodec().MimeType, mimeType) {
+				return encoder, nil
+			}
+		}
+
+		return nil, fmt.Errorf("no video encoder for mime type %s", mimeType)
+	}
+}
+
+// passthroughCodecs are registered for already encoded video, payload types don't clash with mediadevices codecs
+var passthroughCodecs = map[string]webrtc.RTPCodecParameters{
+	webrtc.MimeTypeVP8: {
+		RTPCodecCapability: webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeVP8, ClockRate: 90000},
+		PayloadType:        100,
+	},
+	webrtc.MimeTypeVP9: {
+		RTPCodecCapability: webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeVP9, ClockRate: 90000, SDPFmtpLine: "profile-id=0"},
+		PayloadType:        101,
+	},
+	webrtc.MimeTypeH264: {
+		RTPCodecCapability: webrtc.RTPCodecCapability{
+			MimeType:    webrtc.MimeTypeH264,
+			ClockRate:   90000,
+			SDPFmtpLine: "level-asymmetry-allowed=1;packetization-mode=1;profile-level-id=42e01f",
+		},
+		PayloadType: 102,
+	},
+}
+
+// populateMediaEngine registers the encoders of the codec selector and the codec of the passthrough video if any
+func populateMediaEngine(mediaEngine *webrtc.MediaEngine, codecSelector *mediadevices.CodecSelector, passthroughMimeType string) error {
+	codecSelector.Populate(mediaEngine)
+
+	if passthroughMimeType == "" {
+		return nil
+	}
+
+	codec, ok := passthroughCodecs[passthroughMimeType]
+
+	if !ok {
+		return fmt.Errorf("unsupported passthrough video codec: %s", passthroughMimeType)
+	}
+
+	return mediaEngine.RegisterCodec(codec, webrtc.RTPCodecTypeVideo)
+}
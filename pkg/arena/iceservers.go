@@ -0,0 +1,53 @@
+package arena
+
+import (
+	"encoding/json"
+	"log"
+	"time"
+)
+
+// requestICEServers asks the platform for time-limited TURN credentials, the answer comes as 'ICE_SERVERS' action
+func (a *AnArena) requestICEServers() {
+	type aPayload struct {
+		Token     string `json:"token"`
+		PublicKey string `json:"publicKey"`
+	}
+
+	type anAction struct {
+		Name    string   `json:"name"`
+		Payload aPayload `json:"payload"`
+	}
+
+	message, err := json.Marshal(anAction{
+		Name:    "GET_ICE_SERVERS",
+		Payload: aPayload{Token: a.TokenString, PublicKey: a.PublicKey},
+	})
+
+	if err != nil {
+		log.Println("Serialize 'GET_ICE_SERVERS' message to RoboPortal error", err)
+		return
+	}
+
+	log.Println("Requesting ICE servers from RoboPortal")
+
+	a.WSWriteChan <- string(message)
+}
+
+func (a *AnArena) handleICEServers(payload string) {
+	refreshIn, err := a.iceConfig.SetPlatformServers([]byte(payload))
+
+	if err != nil {
+		log.Println("Parse 'ICE_SERVERS' message from RoboPortal error", err)
+		return
+	}
+
+	log.Println("ICE servers received from RoboPortal, refresh in:", refreshIn)
+
+	if a.iceRefreshTimer != nil {
+		a.iceRefreshTimer.Stop()
+	}
+
+	if refreshIn > 0 {
+		a.iceRefreshTimer = time.AfterFunc(refreshIn, a.requestICEServers)
+	}
+}
@@ -0,0 +1,148 @@
+package arena
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/pion/ice/v3"
+	"github.com/pion/webrtc/v3"
+)
+
+const (
+	MDNSDisabled = "disabled"
+	MDNSQuery    = "query"
+	MDNSGather   = "gather"
+
+	// networkWatchInterval is how often the interfaces are polled to restart ICE after a network change
+	networkWatchInterval = 2 * time.Second
+)
+
+var mdnsModes = map[string]ice.MulticastDNSMode{
+	MDNSDisabled: ice.MulticastDNSModeDisabled,
+	MDNSQuery:    ice.MulticastDNSModeQueryOnly,
+	MDNSGather:   ice.MulticastDNSModeQueryAndGather,
+}
+
+type ICENetworkParams struct {
+	// Interfaces used for candidates, all when empty
+	Interfaces         []string
+	ExcludedInterfaces []string
+	UDPPortMin         int
+	UDPPortMax         int
+	// NAT1To1IPs are advertised in place of the local addresses (host) or as server reflexive candidates (srflx)
+	NAT1To1IPs           []string
+	NAT1To1CandidateType string
+	// MDNSMode is disabled, query or gather, pion default when empty
+	MDNSMode      string
+	IsIPv6Enabled bool
+	// UDPMuxPort multiplexes all peer connections over a single UDP port, 0 - disabled
+	UDPMuxPort int
+}
+
+func (p ICENetworkParams) Validate() error {
+	if (p.UDPPortMin == 0) != (p.UDPPortMax == 0) {
+		return fmt.Errorf("both ends of ICE UDP port range should be set: %d-%d", p.UDPPortMin, p.UDPPortMax)
+	}
+
+	if p.UDPPortMin < 0 || p.UDPPortMax > 65535 || p.UDPPortMin > p.UDPPortMax {
+		return fmt.Errorf("wrong ICE UDP port range: %d-%d", p.UDPPortMin, p.UDPPortMax)
+	}
+
+	if p.UDPMuxPort < 0 || p.UDPMuxPort > 65535 {
+		return fmt.Errorf("wrong ICE UDP mux port: %d", p.UDPMuxPort)
+	}
+
+	if p.NAT1To1CandidateType != "" && p.NAT1To1CandidateType != "host" && p.NAT1To1CandidateType != "srflx" {
+		return fmt.Errorf("unknown NAT 1:1 candidate type: %s", p.NAT1To1CandidateType)
+	}
+
+	if _, ok := mdnsModes[p.MDNSMode]; p.MDNSMode != "" && !ok {
+		return fmt.Errorf("unknown mDNS mode: %s", p.MDNSMode)
+	}
+
+	return nil
+}
+
+func (p ICENetworkParams) isInterfaceAllowed(name string) bool {
+	for _, excluded := range p.ExcludedInterfaces {
+		if excluded == name {
+			return false
+		}
+	}
+
+	if len(p.Interfaces) == 0 {
+		return true
+	}
+
+	for _, allowed := range p.Interfaces {
+		if allowed == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// buildSettingEngine applies the network options shared by all bots, the UDP mux socket is opened here
+func buildSettingEngine(p ICENetworkParams) (webrtc.SettingEngine, error) {
+	settingEngine := webrtc.SettingEngine{}
+
+	if len(p.Interfaces) > 0 || len(p.ExcludedInterfaces) > 0 {
+		log.Println("ICE interfaces:", p.Interfaces, "excluded:", p.ExcludedInterfaces)
+		settingEngine.SetInterfaceFilter(p.isInterfaceAllowed)
+	}
+
+	if p.UDPPortMin != 0 {
+		log.Println("ICE UDP port range:", p.UDPPortMin, p.UDPPortMax)
+
+		err := settingEngine.SetEphemeralUDPPortRange(uint16(p.UDPPortMin), uint16(p.UDPPortMax))
+
+		if err != nil {
+			return settingEngine, err
+		}
+	}
+
+	if len(p.NAT1To1IPs) > 0 {
+		candidateType := webrtc.ICECandidateTypeHost
+
+		if p.NAT1To1CandidateType == "srflx" {
+			candidateType = webrtc.ICECandidateTypeSrflx
+		}
+
+		log.Println("ICE NAT 1:1 IPs:", p.NAT1To1IPs, candidateType)
+		settingEngine.SetNAT1To1IPs(p.NAT1To1IPs, candidateType)
+	}
+
+	if mode, ok := mdnsModes[p.MDNSMode]; ok {
+		settingEngine.SetICEMulticastDNSMode(mode)
+	}
+
+	networkTypes := []webrtc.NetworkType{webrtc.NetworkTypeUDP4, webrtc.NetworkTypeTCP4}
+	muxNetworks := []ice.NetworkType{ice.NetworkTypeUDP4}
+
+	if p.IsIPv6Enabled {
+		networkTypes = append(networkTypes, webrtc.NetworkTypeUDP6, webrtc.NetworkTypeTCP6)
+		muxNetworks = append(muxNetworks, ice.NetworkTypeUDP6)
+	}
+
+	settingEngine.SetNetworkTypes(networkTypes)
+
+	if p.UDPMuxPort != 0 {
+		log.Println("ICE UDP mux port:", p.UDPMuxPort)
+
+		udpMux, err := ice.NewMultiUDPMuxFromPort(
+			p.UDPMuxPort,
+			ice.UDPMuxFromPortWithInterfaceFilter(p.isInterfaceAllowed),
+			ice.UDPMuxFromPortWithNetworks(muxNetworks...),
+		)
+
+		if err != nil {
+			return settingEngine, err
+		}
+
+		settingEngine.SetICEUDPMux(udpMux)
+	}
+
+	return settingEngine, nil
+}
@@ -0,0 +1,38 @@
+package arena
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/roboportal/bot_box/pkg/botcom"
+	"github.com/roboportal/bot_box/pkg/rtspserver"
+)
+
+// startRTSP serves the camera over RTSP, the frames of the opened camera are encoded once more for the RTSP viewers
+func (a *AnArena) startRTSP(cameras []botcom.Camera) {
+	if a.rtsp.Address == "" {
+		return
+	}
+
+	track, err := findBroadcastTrack(cameras, a.rtspCamera)
+
+	if err != nil {
+		log.Println("Start RTSP server error", err)
+		panic(err)
+	}
+
+	source, ok := track.(rtspserver.Source)
+
+	if !ok {
+		err = fmt.Errorf("RTSP requires a camera encoded by Bot Box, pipe passthrough is not supported")
+		log.Println("Start RTSP server error", err)
+		panic(err)
+	}
+
+	err = rtspserver.Serve(source, a.rtsp)
+
+	if err != nil {
+		log.Println("Start RTSP server error", err)
+		panic(err)
+	}
+}
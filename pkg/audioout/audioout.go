@@ -0,0 +1,126 @@
+// Package audioout plays the operator audio on the robot speaker, the sessions of all the bots share one device
+package audioout
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/faiface/beep"
+	"github.com/faiface/beep/effects"
+	"github.com/faiface/beep/speaker"
+)
+
+const (
+	// SourceSampleRate of the decoded operator audio
+	SourceSampleRate = 48000
+
+	resampleQuality = 4
+)
+
+type Config struct {
+	// Card is ALSA card name or index, the default device is used when empty
+	Card string
+	// Device is ALSA device index on the card, the default device of the card is used when empty
+	Device string
+	// SampleRate of the output device, the operator audio is resampled when it differs from 48 kHz
+	SampleRate int
+	// Gain in dB applied to the operator audio, could be negative
+	Gain float64
+}
+
+func (c Config) Validate() error {
+	if c.SampleRate < 8000 || c.SampleRate > 192000 {
+		return fmt.Errorf("audio output sample rate should be in 8000-192000 range: %d", c.SampleRate)
+	}
+
+	if c.Gain < -60 || c.Gain > 30 {
+		return fmt.Errorf("audio output gain should be in -60-30 dB range: %v", c.Gain)
+	}
+
+	return nil
+}
+
+var config Config
+
+// Init opens the output device, oto opens ALSA 'default' device, so the card is selected with the variables
+// of the default ALSA configuration
+func Init(c Config) error {
+	if c.Card != "" {
+		os.Setenv("ALSA_PCM_CARD", c.Card)
+	}
+
+	if c.Device != "" {
+		os.Setenv("ALSA_PCM_DEVICE", c.Device)
+	}
+
+	sr := beep.SampleRate(c.SampleRate)
+
+	err := speaker.Init(sr, sr.N(time.Second/5))
+
+	if err != nil {
+		return err
+	}
+
+	config = c
+
+	log.Println("Audio output opened:", c.Card, c.Device, c.SampleRate)
+
+	return nil
+}
+
+// APlayback is the operator audio of a session mixed into the speaker output
+type APlayback struct {
+	volume    *effects.Volume
+	isStopped bool
+}
+
+// Play mixes the operator audio decoded at SourceSampleRate into the speaker output
+func Play(streamer beep.Streamer, isMuted bool) *APlayback {
+	sr := beep.SampleRate(config.SampleRate)
+
+	if sr != SourceSampleRate {
+		streamer = beep.Resample(resampleQuality, SourceSampleRate, sr, streamer)
+	}
+
+	p := &APlayback{
+		volume: &effects.Volume{
+			Streamer: streamer,
+			Base:     10,
+			Volume:   config.Gain / 20,
+			Silent:   isMuted,
+		},
+	}
+
+	speaker.Play(p)
+
+	return p
+}
+
+func (p *APlayback) Stream(samples [][2]float64) (int, bool) {
+	if p.isStopped {
+		return 0, false
+	}
+
+	return p.volume.Stream(samples)
+}
+
+func (p *APlayback) Err() error {
+	return p.volume.Err()
+}
+
+func (p *APlayback) SetMuted(state bool) {
+	speaker.Lock()
+	defer speaker.Unlock()
+
+	p.volume.Silent = state
+}
+
+// Stop removes the playback from the speaker output
+func (p *APlayback) Stop() {
+	speaker.Lock()
+	defer speaker.Unlock()
+
+	p.isStopped = true
+}
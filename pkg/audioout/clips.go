@@ -0,0 +1,184 @@
+package audioout
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/faiface/beep"
+	"github.com/faiface/beep/mp3"
+	"github.com/faiface/beep/speaker"
+	"github.com/faiface/beep/vorbis"
+	"github.com/faiface/beep/wav"
+)
+
+const (
+	// EventOperatorConnected - the data channel of the operator is open
+	EventOperatorConnected = "operator_connected"
+	// EventControlsEnabled - the operator is ready to drive the robot
+	EventControlsEnabled = "controls_enabled"
+	// EventLinkLost - the connection to the operator is disconnected or failed
+	EventLinkLost = "link_lost"
+)
+
+type ClipsConfig struct {
+	// Directory with .wav, .mp3 and .ogg clips, a clip is named after its file without the extension
+	Directory string
+	// Events maps the lifecycle events to the clip names, empty names are not played
+	Events map[string]string
+}
+
+func (c ClipsConfig) IsEnabled() bool {
+	return c.Directory != ""
+}
+
+func (c ClipsConfig) Validate() error {
+	for event, name := range c.Events {
+		if name == "" {
+			continue
+		}
+
+		if event != EventOperatorConnected && event != EventControlsEnabled && event != EventLinkLost {
+			return fmt.Errorf("unknown sound clip event: %s", event)
+		}
+
+		if !c.IsEnabled() {
+			return fmt.Errorf("sound clips directory is not set for %s clip: %s", event, name)
+		}
+	}
+
+	if !c.IsEnabled() {
+		return nil
+	}
+
+	info, err := os.Stat(c.Directory)
+
+	if err != nil {
+		return err
+	}
+
+	if !info.IsDir() {
+		return fmt.Errorf("sound clips directory is not a directory: %s", c.Directory)
+	}
+
+	return nil
+}
+
+var clips = make(map[string]*beep.Buffer)
+var eventClips = make(map[string]string)
+
+func decodeClip(path string) (beep.StreamSeekCloser, beep.Format, error) {
+	f, err := os.Open(path)
+
+	if err != nil {
+		return nil, beep.Format{}, err
+	}
+
+	var streamer beep.StreamSeekCloser
+	var format beep.Format
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".wav":
+		streamer, format, err = wav.Decode(f)
+	case ".mp3":
+		streamer, format, err = mp3.Decode(f)
+	default:
+		streamer, format, err = vorbis.Decode(f)
+	}
+
+	if err != nil {
+		f.Close()
+	}
+
+	return streamer, format, err
+}
+
+// loadClip decodes the whole clip resampled to the speaker sample rate, so it is played without decoding
+func loadClip(path string) (*beep.Buffer, error) {
+	streamer, format, err := decodeClip(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer streamer.Close()
+
+	sr := beep.SampleRate(config.SampleRate)
+	buffer := beep.NewBuffer(beep.Format{SampleRate: sr, NumChannels: 2, Precision: 2})
+
+	buffer.Append(beep.Resample(resampleQuality, format.SampleRate, sr, streamer))
+
+	return buffer, streamer.Err()
+}
+
+// LoadClips decodes the clips of the directory, the speaker should be opened with Init
+func LoadClips(c ClipsConfig) error {
+	files, err := ioutil.ReadDir(c.Directory)
+
+	if err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		ext := strings.ToLower(filepath.Ext(file.Name()))
+
+		if file.IsDir() || (ext != ".wav" && ext != ".mp3" && ext != ".ogg") {
+			continue
+		}
+
+		buffer, err := loadClip(filepath.Join(c.Directory, file.Name()))
+
+		if err != nil {
+			return fmt.Errorf("load sound clip %s: %v", file.Name(), err)
+		}
+
+		clips[strings.TrimSuffix(file.Name(), filepath.Ext(file.Name()))] = buffer
+	}
+
+	for event, name := range c.Events {
+		if name == "" {
+			continue
+		}
+
+		if _, ok := clips[name]; !ok {
+			return fmt.Errorf("sound clip of %s event is not found: %s", event, name)
+		}
+
+		eventClips[event] = name
+	}
+
+	log.Println("Sound clips loaded:", len(clips))
+
+	return nil
+}
+
+// PlayClip mixes the clip into the speaker output, the operator audio and other clips keep playing
+func PlayClip(name string) error {
+	buffer, ok := clips[name]
+
+	if !ok {
+		return fmt.Errorf("unknown sound clip: %s", name)
+	}
+
+	speaker.Play(buffer.Streamer(0, buffer.Len()))
+
+	return nil
+}
+
+// PlayEvent plays the clip of the lifecycle event, nothing is played when the event has no clip
+func PlayEvent(event string) {
+	name, ok := eventClips[event]
+
+	if !ok {
+		return
+	}
+
+	err := PlayClip(name)
+
+	if err != nil {
+		log.Println("Play sound clip error:", event, err)
+	}
+}
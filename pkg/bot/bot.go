@@ -4,17 +4,28 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
+	"sync"
+	"time"
 
+	"github.com/pion/interceptor/pkg/cc"
 	"github.com/pion/mediadevices"
 	"github.com/pion/webrtc/v3"
 	"github.com/roboportal/bot_box/pkg/botcom"
+	"github.com/roboportal/bot_box/pkg/macro"
+	"github.com/roboportal/bot_box/pkg/micproc"
+	"github.com/roboportal/bot_box/pkg/peertrack"
+	"github.com/roboportal/bot_box/pkg/permissions"
+	"github.com/roboportal/bot_box/pkg/pipesink"
+	"github.com/roboportal/bot_box/pkg/recorder"
+	"github.com/roboportal/bot_box/pkg/snapshot"
 	"github.com/roboportal/bot_box/pkg/utils"
 )
 
 const (
-	Idle       = "Idle"
-	Connecting = "Connecting"
-	Connected  = "Connected"
+	Idle         = "Idle"
+	Connecting   = "Connecting"
+	Connected    = "Connected"
+	Reconnecting = "Reconnecting"
 )
 
 type ABot struct {
@@ -28,10 +39,18 @@ type ABot struct {
 	SendDataChan              chan string
 	WSConStatChan             chan string
 	ControlsReadyChan         chan bool
+	ModeChan                  chan botcom.ModeChange
+	AbortMacroChan            chan struct{}
 	ID                        int
 	Status                    string
 	IsReady                   bool
 	ConnectionID              string
+	permissionsMux            sync.Mutex
+	permissions               *permissions.Claims
+	modeMux                   sync.Mutex
+	mode                      string
+	telemetryMux              sync.Mutex
+	telemetry                 json.RawMessage
 }
 
 func (b *ABot) SetIdle() {
@@ -48,11 +67,76 @@ func (b *ABot) SetConnected() {
 	b.Status = Connected
 }
 
+func (b *ABot) SetReconnecting() {
+	b.Status = Reconnecting
+}
+
 func (b *ABot) ClearConnectionID() {
 	b.ConnectionID = ""
 }
 
+func (b *ABot) GetMode() string {
+	b.modeMux.Lock()
+	defer b.modeMux.Unlock()
+
+	return b.mode
+}
+
+// setMode returns the previous mode
+func (b *ABot) setMode(mode string) string {
+	b.modeMux.Lock()
+	defer b.modeMux.Unlock()
+
+	previous := b.mode
+	b.mode = mode
+
+	return previous
+}
+
+// SetTelemetry keeps the latest robot telemetry message for the snapshot metadata
+func (b *ABot) SetTelemetry(message string) {
+	b.telemetryMux.Lock()
+	defer b.telemetryMux.Unlock()
+
+	b.telemetry = json.RawMessage(message)
+}
+
+func (b *ABot) GetTelemetry() json.RawMessage {
+	b.telemetryMux.Lock()
+	defer b.telemetryMux.Unlock()
+
+	return b.telemetry
+}
+
+// SetPermissions of the operator is called by the arena on the session start, while the callbacks of the previous
+// session could still read them
+func (b *ABot) SetPermissions(claims *permissions.Claims) {
+	b.permissionsMux.Lock()
+	defer b.permissionsMux.Unlock()
+
+	b.permissions = claims
+}
+
+func (b *ABot) GetPermissions() *permissions.Claims {
+	b.permissionsMux.Lock()
+	defer b.permissionsMux.Unlock()
+
+	return b.permissions
+}
+
+// AbortMacro stops the running macro when the controls are taken away from the operator
+func (b *ABot) AbortMacro() {
+	select {
+	case b.AbortMacroChan <- struct{}{}:
+	default:
+	}
+}
+
 func (b *ABot) NotifyAreControlsAllowedBySupervisorChange(state bool) {
+	if !state {
+		b.AbortMacro()
+	}
+
 	if b.Status != Connected {
 		return
 	}
@@ -67,11 +151,12 @@ func (b *ABot) NotifyAreControlsAllowedBySupervisorChange(state bool) {
 }
 
 type RunParams struct {
-	StunUrls                          []string
+	GetICEConfiguration               func() webrtc.Configuration
 	TokenString                       string
 	PublicKey                         string
 	Api                               *webrtc.API
 	MediaStream                       mediadevices.MediaStream
+	Cameras                           []botcom.Camera
 	WsWriteChan                       chan string
 	BotCommandsWriteChan              chan string
 	GetAreControlsAllowedBySupervisor func() bool
@@ -80,6 +165,18 @@ type RunParams struct {
 	SetBotNotReady                    func(int)
 	IsAudioOutputEnabled              bool
 	CameraSelectChan          				chan string
+	GetIsLocalControlActive           func(int) bool
+	Macros                            macro.Config
+	VideoTrackConfig                  *peertrack.Config
+	EstimatorChan                     chan cc.BandwidthEstimator
+	ReportRTT                         func(int, time.Duration)
+	Snapshot                          snapshot.Config
+	Recording                         recorder.Config
+	TapChan                           chan *recorder.Tap
+	ICERestartGracePeriod             time.Duration
+	NetworkChangeChan                 chan struct{}
+	AudioSink                         *pipesink.ASink
+	AudioProcessor                    *micproc.AProcessor
 }
 
 type CreateConnectionPayload struct {
@@ -122,9 +219,10 @@ func (b *ABot) Run(p RunParams) {
 
 	botcomParams := botcom.InitParams{
 		Id:                                b.ID,
-		StunUrls:                          p.StunUrls,
+		GetICEConfiguration:               p.GetICEConfiguration,
 		Api:                               p.Api,
 		MediaStream:                       p.MediaStream,
+		Cameras:                           p.Cameras,
 		DescriptionChan:                   b.DescriptionChan,
 		CandidateChan:                     b.CandidateChan,
 		ArenaDescriptionChan:              b.ArenaDescriptionChan,
@@ -140,6 +238,23 @@ func (b *ABot) Run(p RunParams) {
 		IsAudioOutputEnabled:              p.IsAudioOutputEnabled,
 		ClearBotConnectionID:              b.ClearConnectionID,
 		CameraSelectChan: 								 p.CameraSelectChan,
+		GetIsLocalControlActive:           p.GetIsLocalControlActive,
+		GetMode:                           b.GetMode,
+		ModeChan:                          b.ModeChan,
+		AbortMacroChan:                    b.AbortMacroChan,
+		Macros:                            p.Macros,
+		GetPermissions:                    b.GetPermissions,
+		VideoTrackConfig:                  p.VideoTrackConfig,
+		EstimatorChan:                     p.EstimatorChan,
+		ReportRTT:                         p.ReportRTT,
+		Snapshot:                          p.Snapshot,
+		GetTelemetry:                      b.GetTelemetry,
+		Recording:                         p.Recording,
+		TapChan:                           p.TapChan,
+		ICERestartGracePeriod:             p.ICERestartGracePeriod,
+		NetworkChangeChan:                 p.NetworkChangeChan,
+		AudioSink:                         p.AudioSink,
+		AudioProcessor:                    p.AudioProcessor,
 	}
 
 	log.Println("Init webrtc communicator for bot: ", b.ID)
@@ -162,7 +277,7 @@ func (b *ABot) Run(p RunParams) {
 				Payload SetDescriptionPayload `json:"payload"`
 			}
 
-			log.Println("Sending answer for bot: ", b.ID)
+			log.Println("Sending description for bot: ", b.ID, description.Type)
 			message := SetOfferAction{
 				Name: "SET_DESCRIPTION",
 				Payload: SetDescriptionPayload{
@@ -216,6 +331,17 @@ func (b *ABot) Run(p RunParams) {
 			p.WsWriteChan <- string(b)
 
 		case state := <-b.WebRTCConnectionStateChan:
+			if state == botcom.StateReconnecting && b.Status == Connected {
+				log.Println("Bot connection lost, reconnecting: ", b.ID)
+				b.SetReconnecting()
+			}
+
+			if state == webrtc.ICEConnectionStateConnected.String() && b.Status == Reconnecting {
+				log.Println("Bot reconnected via WebRTC: ", b.ID)
+				b.SetConnected()
+				continue
+			}
+
 			if state == webrtc.ICEConnectionStateConnected.String() {
 				b.SetConnected()
 
@@ -305,6 +431,27 @@ func (b *ABot) Run(p RunParams) {
 				p.SetBotNotReady(b.ID)
 			}
 
+		case change := <-b.ModeChan:
+			previous := b.setMode(change.Mode)
+
+			if previous == change.Mode {
+				continue
+			}
+
+			log.Println("Bot mode changed:", b.ID, previous, "->", change.Mode, "by", change.Source)
+
+			if change.Mode == botcom.ModeAutonomous {
+				b.AbortMacro()
+			}
+
+			if change.Source != botcom.ModeSourceRobot {
+				botcom.SendMode(p.BotCommandsWriteChan, b.ID, change.Mode)
+			}
+
+			if b.Status == Connected {
+				b.SendDataChan <- botcom.BuildModeChangeMessage(change.Mode, change.Source)
+			}
+
 		case wsConnectionStatus := <-b.WSConStatChan:
 			if wsConnectionStatus == "connected" {
 				log.Println("RE-creating connection for bot: ", b.ID)
@@ -335,10 +482,13 @@ func Factory(id int) ABot {
 		ArenaCandidateChan:        make(chan webrtc.ICECandidateInit, 10),
 		SendDataChan:              make(chan string, 1000),
 		ControlsReadyChan:         make(chan bool, 10),
+		ModeChan:                  make(chan botcom.ModeChange, 10),
+		AbortMacroChan:            make(chan struct{}, 1),
 		WSConStatChan:             make(chan string, 10),
 		ID:                        id,
 		Status:                    Idle,
 		IsReady:                   false,
 		ConnectionID:              "",
+		mode:                      botcom.ModeManual,
 	}
 }
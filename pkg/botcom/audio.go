@@ -0,0 +1,111 @@
+package botcom
+
+import (
+	"encoding/json"
+	"log"
+	"sync"
+
+	"github.com/faiface/beep"
+	"github.com/pion/webrtc/v3"
+	"github.com/roboportal/bot_box/pkg/audioout"
+)
+
+type microphoneSender struct {
+	track  webrtc.TrackLocal
+	sender *webrtc.RTPSender
+}
+
+// audioControls keeps the mute state of a single peer connection: the muted microphone tracks are detached
+// from the senders, the muted operator audio is mixed silent
+type audioControls struct {
+	mu                sync.Mutex
+	microphones       []microphoneSender
+	playback          *audioout.APlayback
+	isSpeakerMuted    bool
+	isMicrophoneMuted bool
+}
+
+func (a *audioControls) addMicrophone(track webrtc.TrackLocal, sender *webrtc.RTPSender) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.microphones = append(a.microphones, microphoneSender{track: track, sender: sender})
+}
+
+// play mixes the operator audio into the speaker output, muted when the speaker is muted before the track arrives
+func (a *audioControls) play(streamer beep.Streamer) *audioout.APlayback {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.playback = audioout.Play(streamer, a.isSpeakerMuted)
+
+	return a.playback
+}
+
+func (a *audioControls) setSpeakerMuted(state bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.isSpeakerMuted == state {
+		return
+	}
+
+	if a.playback != nil {
+		a.playback.SetMuted(state)
+	}
+
+	log.Println("Speaker muted:", state)
+
+	a.isSpeakerMuted = state
+}
+
+func (a *audioControls) setMicrophoneMuted(state bool) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.isMicrophoneMuted == state {
+		return nil
+	}
+
+	for _, m := range a.microphones {
+		var track webrtc.TrackLocal
+
+		if !state {
+			track = m.track
+		}
+
+		err := m.sender.ReplaceTrack(track)
+
+		if err != nil {
+			return err
+		}
+	}
+
+	log.Println("Microphone muted:", state)
+
+	a.isMicrophoneMuted = state
+
+	return nil
+}
+
+func (a *audioControls) buildAudioStateMessage() string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	type aPayload struct {
+		SpeakerMuted    bool `json:"speakerMuted"`
+		MicrophoneMuted bool `json:"microphoneMuted"`
+	}
+
+	type aMessage struct {
+		Type    string   `json:"type"`
+		Payload aPayload `json:"payload"`
+	}
+
+	message, _ := json.Marshal(aMessage{
+		Type:    "AUDIO_STATE",
+		Payload: aPayload{SpeakerMuted: a.isSpeakerMuted, MicrophoneMuted: a.isMicrophoneMuted},
+	})
+
+	return string(message)
+}
@@ -7,19 +7,26 @@ import (
 	"sync"
 	"time"
 
-	"github.com/faiface/beep"
-	"github.com/faiface/beep/speaker"
+	"github.com/pion/interceptor/pkg/cc"
 	"github.com/pion/mediadevices"
 	_ "github.com/pion/mediadevices/pkg/driver/camera"
 	_ "github.com/pion/mediadevices/pkg/driver/microphone"
 	"github.com/pion/rtcp"
 	"github.com/pion/webrtc/v3"
+	"github.com/roboportal/bot_box/pkg/audioout"
+	"github.com/roboportal/bot_box/pkg/macro"
+	"github.com/roboportal/bot_box/pkg/micproc"
+	"github.com/roboportal/bot_box/pkg/peertrack"
+	"github.com/roboportal/bot_box/pkg/permissions"
+	"github.com/roboportal/bot_box/pkg/pipesink"
+	"github.com/roboportal/bot_box/pkg/recorder"
+	"github.com/roboportal/bot_box/pkg/snapshot"
 	"github.com/roboportal/bot_box/pkg/utils"
 )
 
 type InitParams struct {
 	Id                                int
-	StunUrls                          []string
+	GetICEConfiguration               func() webrtc.Configuration
 	Api                               *webrtc.API
 	MediaStream                       mediadevices.MediaStream
 	DescriptionChan                   chan webrtc.SessionDescription
@@ -37,6 +44,30 @@ type InitParams struct {
 	ClearBotConnectionID              func()
 	IsAudioOutputEnabled              bool
 	CameraSelectChan									chan string
+	GetIsLocalControlActive           func(int) bool
+	GetMode                           func() string
+	ModeChan                          chan ModeChange
+	Macros                            macro.Config
+	GetPermissions                    func() *permissions.Claims
+	Cameras                           []Camera
+	VideoTrackConfig                  *peertrack.Config
+	EstimatorChan                     chan cc.BandwidthEstimator
+	// ReportRTT receives the connection round trip time every second, could be nil
+	ReportRTT    func(int, time.Duration)
+	Snapshot     snapshot.Config
+	GetTelemetry func() json.RawMessage
+	Recording    recorder.Config
+	// TapChan provides the recorder tap of every new peer connection, nil when recording is disabled
+	TapChan chan *recorder.Tap
+	// ICERestartGracePeriod of a lost connection before the session is closed, 0 disables ICE restart
+	ICERestartGracePeriod time.Duration
+	NetworkChangeChan     chan struct{}
+	// AudioSink receives the decoded operator audio, could be nil
+	AudioSink *pipesink.ASink
+	// AudioProcessor of the microphone, nil when the audio input is disabled
+	AudioProcessor *micproc.AProcessor
+	// AbortMacroChan is triggered when the controls are taken away, e.g. by the supervisor or the local controller
+	AbortMacroChan chan struct{}
 }
 
 func haltControls(botCommandsWriteChan chan string, id int) {
@@ -49,21 +80,178 @@ func enableControls(botCommandsWriteChan chan string, id int) {
 	botCommandsWriteChan <- command
 }
 
+func buildPermissionDeniedMessage(msgType string, reason error) string {
+	type aPayload struct {
+		Type   string `json:"type"`
+		Reason string `json:"reason"`
+	}
+
+	type aMessage struct {
+		Type    string   `json:"type"`
+		Payload aPayload `json:"payload"`
+	}
+
+	message, _ := json.Marshal(aMessage{
+		Type:    "PERMISSION_DENIED",
+		Payload: aPayload{Type: msgType, Reason: reason.Error()},
+	})
+
+	return string(message)
+}
+
+func sendVideoBitRate(sendDataChan chan string, stats peertrack.Stats) {
+	payload, err := json.Marshal(stats)
+
+	if err != nil {
+		log.Println("Serialize 'VIDEO_BITRATE' message error", err)
+		return
+	}
+
+	sendDataChan <- fmt.Sprintf("{\"type\": \"VIDEO_BITRATE\", \"payload\": %s}", payload)
+}
+
 func Init(p InitParams) {
 	for {
 		var wg sync.WaitGroup
 		var candidatesMux sync.Mutex
-		var peerConnection *webrtc.PeerConnection
-		var err error
+		var overrideMux sync.Mutex
+		isOverrideActive := false
+
+		var macroMux sync.Mutex
+		var macroCancelChan chan string
+		var macroDoneChan chan struct{}
+
+		var sessionExpiryTimer *time.Timer
+
+		var videoTracksMux sync.Mutex
+		videoTracks := make([]*peertrack.ATrack, 0)
+
+		cameras := newCameraSenders()
+		audio := &audioControls{}
+		channels := &dataChannels{}
+
+		var recordingMux sync.Mutex
+		var recording *recorder.Recording
+		var tap *recorder.Tap
+
+		var restarter *iceRestarter
+
+		areControlsAccepted := func() bool {
+			if !p.GetAreControlsAllowedBySupervisor() {
+				log.Println("Controls blocked by supervisor")
+				return false
+			}
+
+			if !p.GetAreBotsReady() {
+				log.Println("Controls are not allowed yet:", p.Id)
+				return false
+			}
+
+			if p.GetIsLocalControlActive(p.Id) {
+				log.Println("Controls overridden by local controller:", p.Id)
+				return false
+			}
+
+			if restarter != nil && restarter.getIsOnHold() {
+				log.Println("Controls held until connection is restored:", p.Id)
+				return false
+			}
+
+			overrideMux.Lock()
+			isHeldBack := p.GetMode() == ModeAutonomous && !isOverrideActive
+			overrideMux.Unlock()
+
+			if isHeldBack {
+				log.Println("Controls held back in autonomous mode:", p.Id)
+				return false
+			}
+
+			return true
+		}
+
+		// stopMacro waits for the macro to send its safe state, so it does not override the next command
+		stopMacro := func(reason string) {
+			macroMux.Lock()
+			cancelChan, doneChan := macroCancelChan, macroDoneChan
+			macroCancelChan = nil
+			macroMux.Unlock()
+
+			if cancelChan != nil {
+				cancelChan <- reason
+			}
+
+			if doneChan != nil {
+				<-doneChan
+			}
+		}
+
+		sendMacroProgress := func(progress macro.Progress) {
+			payload, err := json.Marshal(progress)
+
+			if err != nil {
+				log.Println("Serialize 'MACRO_PROGRESS' message error", err)
+				return
+			}
 
-		config := webrtc.Configuration{
-			ICEServers: []webrtc.ICEServer{
-				{
-					URLs: p.StunUrls,
-				},
-			},
+			p.SendDataChan <- fmt.Sprintf("{\"type\": \"MACRO_PROGRESS\", \"payload\": %s}", payload)
 		}
 
+		startRecording := func() {
+			recordingMux.Lock()
+			defer recordingMux.Unlock()
+
+			if tap == nil {
+				log.Println("Recording is disabled:", p.Id)
+				return
+			}
+
+			if recording != nil {
+				return
+			}
+
+			r, err := recorder.Start(p.Recording, p.Id)
+
+			if err != nil {
+				log.Println("Start recording error:", p.Id, err)
+				return
+			}
+
+			recording = r
+			tap.SetRecording(r)
+		}
+
+		stopRecording := func() {
+			recordingMux.Lock()
+			defer recordingMux.Unlock()
+
+			if recording == nil {
+				return
+			}
+
+			tap.SetRecording(nil)
+			recording.Stop()
+			recording = nil
+		}
+
+		logRecordingEvent := func(source string, message string) {
+			recordingMux.Lock()
+			defer recordingMux.Unlock()
+
+			if recording != nil {
+				recording.LogEvent(source, message)
+			}
+		}
+
+		sendRecordingStatus := func() {
+			recordingMux.Lock()
+			defer recordingMux.Unlock()
+
+			p.SendDataChan <- buildRecordingMessage(recording)
+		}
+
+		var peerConnection *webrtc.PeerConnection
+		var err error
+
 		pendingCandidates := make([]*webrtc.ICECandidate, 0)
 
 		closeDataChannelChan := make(chan struct{})
@@ -77,7 +265,34 @@ func Init(p InitParams) {
 
 			case description := <-p.DescriptionChan:
 
-				peerConnection, err = p.Api.NewPeerConnection(config)
+				if description.Type == webrtc.SDPTypeAnswer {
+					if restarter == nil {
+						log.Println("Unexpected answer for bot:", p.Id)
+						break
+					}
+
+					err := restarter.handleAnswer(description)
+
+					if err != nil {
+						log.Println("Apply ICE restart answer error", err)
+						break
+					}
+
+					candidatesMux.Lock()
+
+					for _, c := range pendingCandidates {
+						candidate := c.ToJSON()
+						p.ArenaCandidateChan <- candidate
+					}
+
+					pendingCandidates = pendingCandidates[:0]
+
+					candidatesMux.Unlock()
+
+					break
+				}
+
+				peerConnection, err = p.Api.NewPeerConnection(p.GetICEConfiguration())
 
 				if err != nil {
 					log.Println("Create peerConnection error", err)
@@ -85,12 +300,69 @@ func Init(p InitParams) {
 					break
 				}
 
+				var estimator cc.BandwidthEstimator
+
+				select {
+				case estimator = <-p.EstimatorChan:
+				default:
+				}
+
+				select {
+				case newTap := <-p.TapChan:
+					recordingMux.Lock()
+					tap = newTap
+					recordingMux.Unlock()
+				default:
+				}
+
+				if p.Recording.IsAutoStart {
+					startRecording()
+				}
+
+				if p.ICERestartGracePeriod > 0 {
+					restarter = &iceRestarter{
+						id:              p.Id,
+						peerConnection:  peerConnection,
+						descriptionChan: p.ArenaDescriptionChan,
+						gracePeriod:     p.ICERestartGracePeriod,
+						onHold: func() {
+							stopMacro(macro.Aborted)
+							haltControls(p.BotCommandsWriteChan, p.Id)
+						},
+						onResume: func() {
+							enableControls(p.BotCommandsWriteChan, p.Id)
+						},
+						onGiveUp: func() {
+							p.WebRTCConnectionStateChan <- webrtc.ICEConnectionStateFailed.String()
+						},
+					}
+				}
+
 				p.ControlsReadyChan <- false
 
 				log.Println("Disable controls on webrtc start")
 
+				if expiresIn, ok := p.GetPermissions().ExpiresIn(); ok {
+					log.Println("Operator session expires in:", p.Id, expiresIn)
+
+					sessionExpiryTimer = time.AfterFunc(expiresIn, func() {
+						log.Println("Operator session expired:", p.Id)
+						p.SendDataChan <- "{\"type\": \"SESSION_EXPIRED\"}"
+						utils.TriggerChannel(p.ClosePeerConnectionChan)
+					})
+				}
+
 				peerConnection.OnTrack(func(track *webrtc.TrackRemote, receiver *webrtc.RTPReceiver) {
-					if !p.IsAudioOutputEnabled {
+					if !p.IsAudioOutputEnabled && p.AudioSink == nil {
+						recordingMux.Lock()
+						isRecorded := tap != nil
+						recordingMux.Unlock()
+
+						// the operator audio is read only to be recorded
+						if isRecorded {
+							go drainTrack(track)
+						}
+
 						return
 					}
 
@@ -115,29 +387,44 @@ func Init(p InitParams) {
 						}
 					}()
 
-					sr := beep.SampleRate(48000)
+					streamer := Sound(track)
 
-					speaker.Init(sr, sr.N(time.Second/5))
-					speaker.Play(Sound(track))
+					if p.AudioSink != nil {
+						if tee, ok := p.AudioSink.Tee(streamer); ok {
+							streamer = tee
+							defer p.AudioSink.Release()
+						} else {
+							log.Println("Audio sink is busy with another session:", p.Id)
+						}
+					}
 
-					defer speaker.Clear()
-					defer speaker.Close()
+					if p.IsAudioOutputEnabled {
+						playback := audio.play(streamer)
+						defer playback.Stop()
+					} else {
+						go pumpAudio(streamer, doneAudioTrack)
+					}
 
 					<-doneAudioTrack
 				})
 
+				gatheredCandidates := make([]string, 0)
+
 				peerConnection.OnICECandidate(func(c *webrtc.ICECandidate) {
 					log.Println("OnICECandidate bot:", p.Id, c)
 
 					if c == nil {
+						log.Println("ICE candidates gathered for bot:", p.Id, gatheredCandidates)
 						return
 					}
 
+					gatheredCandidates = append(gatheredCandidates, c.String())
+
 					candidatesMux.Lock()
 					defer candidatesMux.Unlock()
 
 					desc := peerConnection.RemoteDescription()
-					if desc == nil {
+					if desc == nil || (restarter != nil && restarter.getIsAwaitingAnswer()) {
 						pendingCandidates = append(pendingCandidates, c)
 					} else {
 						candidate := c.ToJSON()
@@ -145,49 +432,134 @@ func Init(p InitParams) {
 					}
 				})
 
+				isLinkLost := false
+
 				peerConnection.OnICEConnectionStateChange(func(connectionState webrtc.ICEConnectionState) {
 					connectionStateString := connectionState.String()
 					log.Println("ICE Connection State has changed:", p.Id, connectionStateString)
+
+					switch connectionState {
+					case webrtc.ICEConnectionStateConnected:
+						isLinkLost = false
+
+					case webrtc.ICEConnectionStateDisconnected, webrtc.ICEConnectionStateFailed:
+						if !isLinkLost {
+							isLinkLost = true
+							audioout.PlayEvent(audioout.EventLinkLost)
+						}
+					}
+
+					if restarter != nil {
+						connectionStateString = restarter.handleState(connectionState)
+					}
+
 					p.WebRTCConnectionStateChan <- connectionStateString
 				})
 
 				peerConnection.OnDataChannel(func(d *webrtc.DataChannel) {
 					log.Println("New DataChannel:", d.Label(), d.ID())
 
+					d.OnClose(func() {
+						log.Println("Data channel closed:", d.Label(), d.ID())
+						channels.remove(d)
+					})
+
 					// Register channel opening handling
 					d.OnOpen(func() {
 						log.Println("Data channel open:", d.Label(), d.ID())
 
-						state := p.GetAreControlsAllowedBySupervisor()
+						isFirst := channels.open(d)
 
-						enableControls(p.BotCommandsWriteChan, p.Id)
+						sendState := func() {
+							state := p.GetAreControlsAllowedBySupervisor()
+
+							status := "DECLINED"
+
+							if state {
+								status = "ALLOWED"
+							}
+
+							command := fmt.Sprintf("{\"type\": \"CONTROLS_SUPERVISOR_STATUS_CHANGE\", \"payload\": {\"status\": \"%s\"}}", status)
+
+							d.SendText(command)
 
-						status := "DECLINED"
+							d.SendText(BuildModeChangeMessage(p.GetMode(), ModeSourceSession))
+							d.SendText(cameras.buildVideoTracksMessage())
+							d.SendText(audio.buildAudioStateMessage())
 
-						if state {
-							status = "ALLOWED"
+							if p.AudioProcessor != nil {
+								d.SendText(p.AudioProcessor.BuildStateMessage())
+							}
 						}
 
-						command := fmt.Sprintf("{\"type\": \"CONTROLS_SUPERVISOR_STATUS_CHANGE\", \"payload\": {\"status\": \"%s\"}}", status)
+						// the current state is sent over every reliable channel, it could be lost on the unreliable one,
+						// so the unreliable channel opened first gets it only when the Client App opens no reliable one
+						if !isUnreliable(d) {
+							sendState()
+						} else if isFirst {
+							go func() {
+								time.Sleep(reliableChannelTimeout)
+
+								if !channels.hasReliableChannel() {
+									log.Println("No reliable data channel, sending state over unreliable one:", p.Id)
+									sendState()
+								}
+							}()
+						}
 
-						d.SendText(command)
+						if !isFirst {
+							return
+						}
+
+						audioout.PlayEvent(audioout.EventOperatorConnected)
+
+						enableControls(p.BotCommandsWriteChan, p.Id)
+
+						if p.Recording.IsEnabled {
+							sendRecordingStatus()
+						}
+
+						statsTicker := time.NewTicker(time.Second)
+						defer statsTicker.Stop()
 
 						for loop := true; loop; {
 							select {
+							case <-statsTicker.C:
+								if p.ReportRTT == nil {
+									break
+								}
+
+								if rtt, ok := getRoundTripTime(peerConnection); ok {
+									p.ReportRTT(p.Id, rtt)
+								}
+
 							case msg := <-p.SendDataChan:
+								if getMessageType(msg) == "TELEMETRY" {
+									logRecordingEvent("robot", msg)
+								}
+
 								if peerConnection.ICEConnectionState() == webrtc.ICEConnectionStateConnected {
-									err := d.SendText(msg)
+									err := channels.send(msg)
 									if err != nil {
 										log.Println("Send data to Client App over data channel error", err)
 									}
 								} else {
-									log.Println("Sending data to Client App over data channel when not connected", d.Label(), d.ID())
+									log.Println("Sending data to Client App over data channel when not connected:", p.Id)
 								}
 
 							case <-closeDataChannelChan:
 								log.Println("Closing data channel for bot:", p.Id)
+								stopMacro(macro.Cancelled)
 								haltControls(p.BotCommandsWriteChan, p.Id)
-								defer d.Close()
+
+								overrideMux.Lock()
+								if isOverrideActive {
+									isOverrideActive = false
+									sendOverride(p.BotCommandsWriteChan, p.Id, false)
+								}
+								overrideMux.Unlock()
+
+								defer channels.close()
 								return
 							}
 						}
@@ -209,21 +581,30 @@ func Init(p InitParams) {
 							return
 						}
 
+						enforced, err := p.GetPermissions().Enforce(data.Type, msg.Data)
+
+						if err != nil {
+							log.Println("Data channel message declined by operator permissions:", p.Id, data.Type, err)
+							p.SendDataChan <- buildPermissionDeniedMessage(data.Type, err)
+							return
+						}
+
+						message = string(enforced)
+
+						logRecordingEvent("operator", message)
+
 						switch data.Type {
 						case "CONTROLS":
 
-							if !p.GetAreControlsAllowedBySupervisor() {
-								log.Println("Controls blocked by supervisor")
+							if !areControlsAccepted() {
 								break
 							}
 
-							if !p.GetAreBotsReady() {
-								log.Println("Controls are not allowed yet:", p.Id)
-								break
-							}
+							stopMacro(macro.Aborted)
 
 							type aControlsMessage struct {
 								Payload string
+								Seq     *uint32
 							}
 
 							var data aControlsMessage
@@ -234,6 +615,10 @@ func Init(p InitParams) {
 								return
 							}
 
+							if data.Seq != nil && !channels.isControlsSeqFresh(*data.Seq) {
+								break
+							}
+
 							command := fmt.Sprintf("{\"address\":%d,\"controls\":%s}", p.Id, data.Payload)
 
 							p.BotCommandsWriteChan <- command
@@ -241,6 +626,7 @@ func Init(p InitParams) {
 						case "READY":
 							enableControls(p.BotCommandsWriteChan, p.Id)
 							p.ControlsReadyChan <- true
+							audioout.PlayEvent(audioout.EventControlsEnabled)
 
 						case "NOT_READY":
 							haltControls(p.BotCommandsWriteChan, p.Id)
@@ -261,17 +647,276 @@ func Init(p InitParams) {
 							}
 
 							p.CameraSelectChan <- data.Payload
+
+						case "SET_MODE":
+							type aSetModeMessage struct {
+								Payload string
+							}
+
+							var data aSetModeMessage
+							err := json.Unmarshal([]byte(message), &data)
+
+							if err != nil {
+								log.Println("Parse 'SET_MODE' message over data channel from Client App error", err)
+								return
+							}
+
+							if !IsValidMode(data.Payload) {
+								log.Println("Unknown mode requested by Client App:", data.Payload)
+								return
+							}
+
+							p.ModeChan <- ModeChange{Mode: data.Payload, Source: ModeSourceOperator}
+
+						case "OVERRIDE":
+							type aOverrideMessage struct {
+								Payload bool
+							}
+
+							var data aOverrideMessage
+							err := json.Unmarshal([]byte(message), &data)
+
+							if err != nil {
+								log.Println("Parse 'OVERRIDE' message over data channel from Client App error", err)
+								return
+							}
+
+							overrideMux.Lock()
+							if isOverrideActive != data.Payload {
+								log.Println("Operator override:", p.Id, data.Payload)
+								isOverrideActive = data.Payload
+								sendOverride(p.BotCommandsWriteChan, p.Id, data.Payload)
+							}
+							overrideMux.Unlock()
+
+						case "RUN_MACRO":
+							type aRunMacroMessage struct {
+								Payload string
+							}
+
+							var data aRunMacroMessage
+							err := json.Unmarshal([]byte(message), &data)
+
+							if err != nil {
+								log.Println("Parse 'RUN_MACRO' message over data channel from Client App error", err)
+								return
+							}
+
+							if !p.Macros.Has(data.Payload) {
+								log.Println("Macro not found:", data.Payload)
+								sendMacroProgress(macro.Progress{Name: data.Payload, Status: macro.NotFound})
+								break
+							}
+
+							if !areControlsAccepted() {
+								sendMacroProgress(macro.Progress{Name: data.Payload, Status: macro.Declined})
+								break
+							}
+
+							stopMacro(macro.Cancelled)
+
+							cancelChan := make(chan string, 1)
+							doneChan := make(chan struct{})
+
+							macroMux.Lock()
+							macroCancelChan = cancelChan
+							macroDoneChan = doneChan
+							macroMux.Unlock()
+
+							go func(name string) {
+								defer close(doneChan)
+
+								p.Macros.Run(name, macro.RunParams{
+									Address:        p.Id,
+									SendChan:       p.BotCommandsWriteChan,
+									CancelChan:     cancelChan,
+									OnProgress:     sendMacroProgress,
+									FilterControls: p.GetPermissions().FilterControls,
+								})
+
+								macroMux.Lock()
+								if macroDoneChan == doneChan {
+									macroCancelChan = nil
+									macroDoneChan = nil
+								}
+								macroMux.Unlock()
+							}(data.Payload)
+
+						case "CANCEL_MACRO":
+							stopMacro(macro.Cancelled)
+
+						case "SET_VIDEO_QUALITY":
+							type aSetVideoQualityMessage struct {
+								Payload string
+							}
+
+							var data aSetVideoQualityMessage
+							err := json.Unmarshal([]byte(message), &data)
+
+							if err != nil {
+								log.Println("Parse 'SET_VIDEO_QUALITY' message over data channel from Client App error", err)
+								return
+							}
+
+							videoTracksMux.Lock()
+							defer videoTracksMux.Unlock()
+
+							if len(videoTracks) == 0 {
+								log.Println("Video quality could not be set, per-peer encoding is disabled:", p.Id)
+								return
+							}
+
+							for _, track := range videoTracks {
+								err := track.SetQuality(data.Payload)
+
+								if err != nil {
+									log.Println("Set video quality error:", p.Id, err)
+									return
+								}
+							}
+
+						case "SET_VIDEO_TRACK":
+							type aSetVideoTrackMessage struct {
+								Payload struct {
+									Name    string
+									Enabled bool
+								}
+							}
+
+							var data aSetVideoTrackMessage
+							err := json.Unmarshal([]byte(message), &data)
+
+							if err != nil {
+								log.Println("Parse 'SET_VIDEO_TRACK' message over data channel from Client App error", err)
+								return
+							}
+
+							err = cameras.setEnabled(data.Payload.Name, data.Payload.Enabled)
+
+							if err != nil {
+								log.Println("Set video track error:", p.Id, err)
+							}
+
+							p.SendDataChan <- cameras.buildVideoTracksMessage()
+
+						case "SET_SPEAKER_MUTED":
+							type aSetSpeakerMutedMessage struct {
+								Payload bool
+							}
+
+							var data aSetSpeakerMutedMessage
+							err := json.Unmarshal([]byte(message), &data)
+
+							if err != nil {
+								log.Println("Parse 'SET_SPEAKER_MUTED' message over data channel from Client App error", err)
+								return
+							}
+
+							audio.setSpeakerMuted(data.Payload)
+							p.SendDataChan <- audio.buildAudioStateMessage()
+
+						case "SET_MICROPHONE_MUTED":
+							type aSetMicrophoneMutedMessage struct {
+								Payload bool
+							}
+
+							var data aSetMicrophoneMutedMessage
+							err := json.Unmarshal([]byte(message), &data)
+
+							if err != nil {
+								log.Println("Parse 'SET_MICROPHONE_MUTED' message over data channel from Client App error", err)
+								return
+							}
+
+							err = audio.setMicrophoneMuted(data.Payload)
+
+							if err != nil {
+								log.Println("Mute microphone error:", p.Id, err)
+							}
+
+							p.SendDataChan <- audio.buildAudioStateMessage()
+
+						case "SET_AUDIO_PROCESSING":
+							type aSetAudioProcessingMessage struct {
+								Payload struct {
+									Name    string
+									Enabled bool
+								}
+							}
+
+							var data aSetAudioProcessingMessage
+							err := json.Unmarshal([]byte(message), &data)
+
+							if err != nil {
+								log.Println("Parse 'SET_AUDIO_PROCESSING' message over data channel from Client App error", err)
+								return
+							}
+
+							if p.AudioProcessor == nil {
+								log.Println("Audio processing is not available, audio input is disabled:", p.Id)
+								return
+							}
+
+							err = p.AudioProcessor.SetEnabled(data.Payload.Name, data.Payload.Enabled)
+
+							if err != nil {
+								log.Println("Set audio processing error:", p.Id, err)
+							}
+
+							p.SendDataChan <- p.AudioProcessor.BuildStateMessage()
+
+						case "PLAY_SOUND":
+							type aPlaySoundMessage struct {
+								Payload string
+							}
+
+							var data aPlaySoundMessage
+							err := json.Unmarshal([]byte(message), &data)
+
+							if err != nil {
+								log.Println("Parse 'PLAY_SOUND' message over data channel from Client App error", err)
+								return
+							}
+
+							err = audioout.PlayClip(data.Payload)
+
+							if err != nil {
+								log.Println("Play sound clip error:", p.Id, err)
+							}
+
+						case "SNAPSHOT":
+							type aSnapshotMessage struct {
+								Payload snapshotRequest
+							}
+
+							var data aSnapshotMessage
+							err := json.Unmarshal([]byte(message), &data)
+
+							if err != nil {
+								log.Println("Parse 'SNAPSHOT' message over data channel from Client App error", err)
+								return
+							}
+
+							go takeSnapshot(p, data.Payload)
+
+						case "START_RECORDING":
+							startRecording()
+							sendRecordingStatus()
+
+						case "STOP_RECORDING":
+							stopRecording()
+							sendRecordingStatus()
 						}
 
 					})
 				})
 
-				for _, track := range p.MediaStream.GetTracks() {
+				for _, track := range p.MediaStream.GetAudioTracks() {
 					track.OnEnded(func(err error) {
 						log.Println("Track ended with error:", track.ID(), err)
 					})
 
-					_, err = peerConnection.AddTransceiverFromTrack(track,
+					transceiver, err := peerConnection.AddTransceiverFromTrack(track,
 						webrtc.RtpTransceiverInit{
 							Direction: webrtc.RTPTransceiverDirectionSendrecv.Revers(),
 						},
@@ -281,6 +926,53 @@ func Init(p InitParams) {
 						loop = false
 						break
 					}
+
+					audio.addMicrophone(track, transceiver.Sender())
+					nameRecordedTrack(tap, transceiver.Sender(), "audio")
+				}
+
+				for _, camera := range p.Cameras {
+					if !loop {
+						break
+					}
+
+					name := camera.Name
+
+					if track, ok := camera.Track.(mediadevices.Track); ok {
+						track.OnEnded(func(err error) {
+							log.Println("Track ended with error:", name, err)
+						})
+					}
+
+					var localTrack webrtc.TrackLocal = &namedTrack{TrackLocal: camera.Track, name: name}
+
+					if source, ok := camera.Track.(peertrack.Source); ok && p.VideoTrackConfig != nil {
+						log.Println("Creating per-peer video track:", p.Id, name)
+
+						videoTrack := peertrack.New(name, source, *p.VideoTrackConfig, estimator, func(stats peertrack.Stats) {
+							sendVideoBitRate(p.SendDataChan, stats)
+						})
+
+						videoTracksMux.Lock()
+						videoTracks = append(videoTracks, videoTrack)
+						videoTracksMux.Unlock()
+
+						localTrack = videoTrack
+					}
+
+					transceiver, err := peerConnection.AddTransceiverFromTrack(localTrack,
+						webrtc.RtpTransceiverInit{
+							Direction: webrtc.RTPTransceiverDirectionSendrecv.Revers(),
+						},
+					)
+					if err != nil {
+						log.Println("AddTransceiverFromTrack to peerConnection error", err)
+						loop = false
+						break
+					}
+
+					cameras.add(name, localTrack, transceiver.Sender())
+					nameRecordedTrack(tap, transceiver.Sender(), name)
 				}
 
 				if !loop {
@@ -328,6 +1020,14 @@ func Init(p InitParams) {
 					log.Println("AddICECandidate error", err)
 				}
 
+			case <-p.AbortMacroChan:
+				stopMacro(macro.Aborted)
+
+			case <-p.NetworkChangeChan:
+				if restarter != nil {
+					restarter.restart("network change")
+				}
+
 			case <-p.ClosePeerConnectionChan:
 				log.Println("Closing peer connection")
 
@@ -347,6 +1047,16 @@ func Init(p InitParams) {
 			log.Println(peerConnection.ICEConnectionState().String())
 		}
 
+		if sessionExpiryTimer != nil {
+			sessionExpiryTimer.Stop()
+		}
+
+		stopRecording()
+
+		if restarter != nil {
+			restarter.stop()
+		}
+
 		close(doneAudioTrack)
 
 		log.Println("Awaiting for audio gorutine to finish.")
@@ -0,0 +1,114 @@
+package botcom
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+
+	"github.com/pion/webrtc/v3"
+)
+
+// Camera is a video track published in every peer connection under its name.
+// Track is usually a mediadevices.Track, but an already encoded track could be used as well.
+type Camera struct {
+	Name  string
+	Track webrtc.TrackLocal
+}
+
+// namedTrack publishes the camera track under the configured name, so the Client App could tell cameras apart
+type namedTrack struct {
+	webrtc.TrackLocal
+	name string
+}
+
+func (t *namedTrack) ID() string {
+	return t.name
+}
+
+type cameraSender struct {
+	track     webrtc.TrackLocal
+	sender    *webrtc.RTPSender
+	isEnabled bool
+}
+
+// cameraSenders keeps the camera tracks of a single peer connection, disabled cameras are detached from the sender
+// so their frames are not encoded and sent
+type cameraSenders struct {
+	mu      sync.Mutex
+	names   []string
+	senders map[string]*cameraSender
+}
+
+func newCameraSenders() *cameraSenders {
+	return &cameraSenders{
+		names:   make([]string, 0),
+		senders: make(map[string]*cameraSender),
+	}
+}
+
+func (c *cameraSenders) add(name string, track webrtc.TrackLocal, sender *webrtc.RTPSender) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.names = append(c.names, name)
+	c.senders[name] = &cameraSender{track: track, sender: sender, isEnabled: true}
+}
+
+func (c *cameraSenders) setEnabled(name string, state bool) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	s, ok := c.senders[name]
+
+	if !ok {
+		return fmt.Errorf("unknown video track: %s", name)
+	}
+
+	if s.isEnabled == state {
+		return nil
+	}
+
+	var track webrtc.TrackLocal
+
+	if state {
+		track = s.track
+	}
+
+	err := s.sender.ReplaceTrack(track)
+
+	if err != nil {
+		return err
+	}
+
+	log.Println("Video track enabled:", name, state)
+
+	s.isEnabled = state
+
+	return nil
+}
+
+func (c *cameraSenders) buildVideoTracksMessage() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	type aTrack struct {
+		Name    string `json:"name"`
+		Enabled bool   `json:"enabled"`
+	}
+
+	type aMessage struct {
+		Type    string   `json:"type"`
+		Payload []aTrack `json:"payload"`
+	}
+
+	tracks := make([]aTrack, 0, len(c.names))
+
+	for _, name := range c.names {
+		tracks = append(tracks, aTrack{Name: name, Enabled: c.senders[name].isEnabled})
+	}
+
+	message, _ := json.Marshal(aMessage{Type: "VIDEO_TRACKS", Payload: tracks})
+
+	return string(message)
+}
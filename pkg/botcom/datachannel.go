@@ -0,0 +1,127 @@
+package botcom
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/pion/webrtc/v3"
+)
+
+// UnreliableChannelLabel is the label of the data channel opened by the Client App with unordered delivery and
+// 'maxRetransmits' of 0, any other label is reliable
+const UnreliableChannelLabel = "unreliable"
+
+// reliableChannelTimeout is waited for the reliable channel when the unreliable one is opened first, the session
+// state is sent over the unreliable channel only when the Client App opens no other
+const reliableChannelTimeout = time.Second
+
+// unreliableTypes are the high-rate messages to the Client App which are outdated by the next one,
+// a lost message should not hold back the later ones
+var unreliableTypes = map[string]bool{
+	"TELEMETRY": true,
+}
+
+// dataChannels routes the messages to the Client App by the channel label, everything goes over the only
+// open channel when the Client App opens just one
+type dataChannels struct {
+	mu         sync.Mutex
+	reliable   *webrtc.DataChannel
+	unreliable *webrtc.DataChannel
+	isStarted  bool
+	// hasReliable is set once a reliable channel is opened in the session
+	hasReliable bool
+	// controlsSeq is the latest 'seq' of 'CONTROLS' message, the older ones are reordered by the unreliable channel
+	controlsSeq    uint32
+	hasControlsSeq bool
+}
+
+func isUnreliable(d *webrtc.DataChannel) bool {
+	return d.Label() == UnreliableChannelLabel
+}
+
+// open adds the channel, true is returned for the first channel of the session
+func (c *dataChannels) open(d *webrtc.DataChannel) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if isUnreliable(d) {
+		if d.Ordered() || d.MaxRetransmits() == nil || *d.MaxRetransmits() != 0 {
+			log.Println("Data channel is labeled unreliable, but it is ordered or retransmitted:", d.Label(), d.ID())
+		}
+
+		c.unreliable = d
+	} else {
+		c.reliable = d
+		c.hasReliable = true
+	}
+
+	isFirst := !c.isStarted
+	c.isStarted = true
+
+	return isFirst
+}
+
+func (c *dataChannels) hasReliableChannel() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.hasReliable
+}
+
+func (c *dataChannels) remove(d *webrtc.DataChannel) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.reliable == d {
+		c.reliable = nil
+	}
+
+	if c.unreliable == d {
+		c.unreliable = nil
+	}
+}
+
+func (c *dataChannels) send(message string) error {
+	c.mu.Lock()
+	d := c.reliable
+
+	if d == nil || (c.unreliable != nil && unreliableTypes[getMessageType(message)]) {
+		d = c.unreliable
+	}
+	c.mu.Unlock()
+
+	if d == nil {
+		return fmt.Errorf("no open data channel")
+	}
+
+	return d.SendText(message)
+}
+
+func (c *dataChannels) close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, d := range []*webrtc.DataChannel{c.reliable, c.unreliable} {
+		if d != nil {
+			d.Close()
+		}
+	}
+}
+
+// isControlsSeqFresh drops 'CONTROLS' messages reordered by the unreliable channel, the messages without 'seq'
+// are always applied
+func (c *dataChannels) isControlsSeqFresh(seq uint32) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.hasControlsSeq && int32(seq-c.controlsSeq) <= 0 {
+		return false
+	}
+
+	c.controlsSeq = seq
+	c.hasControlsSeq = true
+
+	return true
+}
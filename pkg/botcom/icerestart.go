@@ -0,0 +1,172 @@
+package botcom
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/pion/webrtc/v3"
+)
+
+const (
+	// StateReconnecting is reported to the bot instead of ICE states while the connection is being restored
+	StateReconnecting = "reconnecting"
+
+	// restartRetryInterval is how long the unanswered restart offer is awaited before it is sent again
+	restartRetryInterval = 5 * time.Second
+)
+
+// iceRestarter restores the connection of a session which was connected once: controls are held
+// while ICE is not connected, the restart offer is sent to the operator through the regular signaling
+// and the session is given up only after the grace period
+type iceRestarter struct {
+	mu               sync.Mutex
+	id               int
+	peerConnection   *webrtc.PeerConnection
+	descriptionChan  chan webrtc.SessionDescription
+	gracePeriod      time.Duration
+	hasConnected     bool
+	isOnHold         bool
+	isAwaitingAnswer bool
+	offeredAt        time.Time
+	graceTimer       *time.Timer
+	onHold           func()
+	onResume         func()
+	onGiveUp         func()
+}
+
+// restart creates an offer with new ICE credentials, the offer is not repeated until the retry interval passes
+func (r *iceRestarter) restart(reason string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !r.hasConnected || (r.isAwaitingAnswer && time.Since(r.offeredAt) < restartRetryInterval) {
+		return
+	}
+
+	state := r.peerConnection.SignalingState()
+
+	if state != webrtc.SignalingStateStable && !(r.isAwaitingAnswer && state == webrtc.SignalingStateHaveLocalOffer) {
+		log.Println("ICE restart skipped, negotiation is in progress:", r.id, r.peerConnection.SignalingState())
+		return
+	}
+
+	log.Println("Restarting ICE for bot:", r.id, reason)
+
+	offer, err := r.peerConnection.CreateOffer(&webrtc.OfferOptions{ICERestart: true})
+
+	if err != nil {
+		log.Println("Create ICE restart offer error", err)
+		return
+	}
+
+	err = r.peerConnection.SetLocalDescription(offer)
+
+	if err != nil {
+		log.Println("Set ICE restart offer error", err)
+		return
+	}
+
+	r.isAwaitingAnswer = true
+	r.offeredAt = time.Now()
+	r.descriptionChan <- offer
+}
+
+// handleAnswer applies the operator answer to the restart offer
+func (r *iceRestarter) handleAnswer(description webrtc.SessionDescription) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !r.isAwaitingAnswer {
+		return fmt.Errorf("unexpected answer, no ICE restart in progress")
+	}
+
+	r.isAwaitingAnswer = false
+
+	return r.peerConnection.SetRemoteDescription(description)
+}
+
+func (r *iceRestarter) getIsAwaitingAnswer() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.isAwaitingAnswer
+}
+
+func (r *iceRestarter) getIsOnHold() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.isOnHold
+}
+
+// stop cancels the grace period when the session is closed
+func (r *iceRestarter) stop() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.graceTimer != nil {
+		r.graceTimer.Stop()
+		r.graceTimer = nil
+	}
+
+	r.isOnHold = false
+}
+
+func (r *iceRestarter) giveUp() {
+	r.mu.Lock()
+	isOnHold := r.isOnHold
+	r.mu.Unlock()
+
+	if !isOnHold {
+		return
+	}
+
+	log.Println("Connection was not restored in grace period:", r.id, r.gracePeriod)
+
+	r.onGiveUp()
+}
+
+// handleState holds the controls when the connection is lost and returns the state to report to the bot,
+// sessions which were never connected are reported as is
+func (r *iceRestarter) handleState(state webrtc.ICEConnectionState) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	switch state {
+	case webrtc.ICEConnectionStateConnected:
+		r.hasConnected = true
+
+		if r.graceTimer != nil {
+			r.graceTimer.Stop()
+			r.graceTimer = nil
+		}
+
+		if r.isOnHold {
+			log.Println("Connection restored for bot:", r.id)
+			r.isOnHold = false
+			r.onResume()
+		}
+
+	case webrtc.ICEConnectionStateDisconnected, webrtc.ICEConnectionStateFailed, webrtc.ICEConnectionStateChecking:
+		if !r.hasConnected {
+			break
+		}
+
+		if !r.isOnHold {
+			log.Println("Connection lost, holding controls for bot:", r.id, state)
+			r.isOnHold = true
+			r.onHold()
+			r.graceTimer = time.AfterFunc(r.gracePeriod, r.giveUp)
+		}
+
+		if state != webrtc.ICEConnectionStateChecking {
+			go r.restart("ICE " + state.String())
+		}
+
+		return StateReconnecting
+	}
+
+	return state.String()
+}
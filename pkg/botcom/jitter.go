@@ -0,0 +1,170 @@
+package botcom
+
+import (
+	"sync"
+
+	"github.com/pion/rtp"
+)
+
+const (
+	opusSampleRate = 48000
+
+	// jitterTargetDelay in samples is buffered before the playback starts and after every underrun
+	jitterTargetDelay = opusSampleRate * 60 / 1000
+	// jitterMaxDelay in samples limits the latency, the oldest packets are dropped when more is buffered
+	jitterMaxDelay = opusSampleRate * 300 / 1000
+	// maxConcealedFrames in a row, the playback skips to the next packet after a longer gap, e.g. a sender restart
+	maxConcealedFrames = 5
+)
+
+// aFrame is the next frame to play: the packet or, when it is lost, the following packet to recover it with FEC
+type aFrame struct {
+	packet *rtp.Packet
+	fec    *rtp.Packet
+}
+
+type jitterStats struct {
+	received   int
+	late       int
+	lost       int
+	overflowed int
+	underruns  int
+}
+
+// jitterBuffer orders the packets by the sequence number and holds them back to absorb the network jitter
+type jitterBuffer struct {
+	mu        sync.Mutex
+	packets   map[uint16]*rtp.Packet
+	isPlaying bool
+	nextSeq   uint16
+	isEnded   bool
+	stats     jitterStats
+}
+
+func newJitterBuffer() *jitterBuffer {
+	return &jitterBuffer{packets: make(map[uint16]*rtp.Packet)}
+}
+
+// isSeqBefore compares the sequence numbers with the wrap around
+func isSeqBefore(a uint16, b uint16) bool {
+	return int16(a-b) < 0
+}
+
+// bounds returns the oldest and the newest packets, the buffer should not be empty
+func (b *jitterBuffer) bounds() (*rtp.Packet, *rtp.Packet) {
+	var oldest, newest *rtp.Packet
+
+	for _, packet := range b.packets {
+		if oldest == nil || isSeqBefore(packet.SequenceNumber, oldest.SequenceNumber) {
+			oldest = packet
+		}
+
+		if newest == nil || isSeqBefore(newest.SequenceNumber, packet.SequenceNumber) {
+			newest = packet
+		}
+	}
+
+	return oldest, newest
+}
+
+// delay in samples between the oldest and the newest packets
+func (b *jitterBuffer) delay() uint32 {
+	if len(b.packets) == 0 {
+		return 0
+	}
+
+	oldest, newest := b.bounds()
+
+	return newest.Timestamp - oldest.Timestamp
+}
+
+func (b *jitterBuffer) push(packet *rtp.Packet) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.stats.received++
+
+	if b.isPlaying && isSeqBefore(packet.SequenceNumber, b.nextSeq) {
+		b.stats.late++
+		return
+	}
+
+	b.packets[packet.SequenceNumber] = packet
+
+	for b.delay() > jitterMaxDelay {
+		oldest, _ := b.bounds()
+		delete(b.packets, oldest.SequenceNumber)
+		b.stats.overflowed++
+
+		if b.isPlaying && !isSeqBefore(oldest.SequenceNumber, b.nextSeq) {
+			b.nextSeq = oldest.SequenceNumber + 1
+		}
+	}
+}
+
+// pop returns the next frame, false is returned on underrun and until the target delay is buffered again
+func (b *jitterBuffer) pop() (aFrame, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if !b.isPlaying {
+		if len(b.packets) == 0 || (b.delay() < jitterTargetDelay && !b.isEnded) {
+			return aFrame{}, false
+		}
+
+		oldest, _ := b.bounds()
+		b.nextSeq = oldest.SequenceNumber
+		b.isPlaying = true
+	}
+
+	if len(b.packets) == 0 {
+		b.isPlaying = false
+		b.stats.underruns++
+
+		return aFrame{}, false
+	}
+
+	if _, ok := b.packets[b.nextSeq]; !ok {
+		oldest, _ := b.bounds()
+
+		if int16(oldest.SequenceNumber-b.nextSeq) > maxConcealedFrames {
+			b.stats.lost += int(oldest.SequenceNumber - b.nextSeq)
+			b.nextSeq = oldest.SequenceNumber
+		}
+	}
+
+	seq := b.nextSeq
+	b.nextSeq++
+
+	if packet, ok := b.packets[seq]; ok {
+		delete(b.packets, seq)
+		return aFrame{packet: packet}, true
+	}
+
+	b.stats.lost++
+
+	return aFrame{fec: b.packets[seq+1]}, true
+}
+
+// end marks the end of the track, the rest of the packets is played without waiting for the target delay
+func (b *jitterBuffer) end() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.isEnded = true
+}
+
+// isDrained is true when the track is ended and all the packets are played
+func (b *jitterBuffer) isDrained() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.isEnded && len(b.packets) == 0
+}
+
+func (b *jitterBuffer) getStats() jitterStats {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.stats
+}
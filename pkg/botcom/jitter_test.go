@@ -0,0 +1,267 @@
+package botcom
+
+import (
+	"testing"
+
+	"github.com/pion/rtp"
+	"gopkg.in/hraban/opus.v2"
+)
+
+// frameSamples of the test packets, 20ms Opus frames
+const frameSamples = 960
+
+// newPacket returns a packet of the continuous stream, the payload is a single byte Opus frame
+func newPacket(seq uint16, frame int) *rtp.Packet {
+	return &rtp.Packet{
+		Header:  rtp.Header{SequenceNumber: seq, Timestamp: uint32(frame * frameSamples)},
+		Payload: []byte{0xf8},
+	}
+}
+
+func pushFrames(b *jitterBuffer, first uint16, frames ...int) {
+	for _, frame := range frames {
+		b.push(newPacket(first+uint16(frame), frame))
+	}
+}
+
+func popSequence(t *testing.T, b *jitterBuffer) uint16 {
+	frame, ok := b.pop()
+
+	if !ok || frame.packet == nil {
+		t.Fatalf("packet is not popped: %v %v", ok, frame)
+	}
+
+	return frame.packet.SequenceNumber
+}
+
+func newTestPlayer(t *testing.T, b *jitterBuffer) *aPlayer {
+	decoder, err := opus.NewDecoder(opusSampleRate, 1)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &aPlayer{
+		buffer:    b,
+		decoder:   decoder,
+		pcm:       make([]float32, 0, maxFrameSize*2),
+		frame:     make([]float32, maxFrameSize),
+		frameSize: defaultFrameSize,
+	}
+}
+
+func TestIsSeqBeforeWrapsAround(t *testing.T) {
+	cases := []struct {
+		a, b     uint16
+		expected bool
+	}{
+		{1, 2, true},
+		{2, 1, false},
+		{7, 7, false},
+		{65535, 0, true},
+		{0, 65535, false},
+		{65500, 20, true},
+		{20, 65500, false},
+	}
+
+	for _, c := range cases {
+		if isSeqBefore(c.a, c.b) != c.expected {
+			t.Errorf("isSeqBefore(%d, %d) should be %v", c.a, c.b, c.expected)
+		}
+	}
+}
+
+func TestJitterBufferWaitsForTargetDelayAndReorders(t *testing.T) {
+	b := newJitterBuffer()
+
+	pushFrames(b, 10, 0, 2, 1)
+
+	if _, ok := b.pop(); ok {
+		t.Fatal("playback should wait for the target delay")
+	}
+
+	pushFrames(b, 10, 3)
+
+	for expected := uint16(10); expected <= 13; expected++ {
+		if seq := popSequence(t, b); seq != expected {
+			t.Fatalf("unexpected sequence: %d, expected %d", seq, expected)
+		}
+	}
+
+	pushFrames(b, 10, 1)
+
+	if stats := b.getStats(); stats.late != 1 || stats.received != 5 {
+		t.Fatalf("late packet is not counted: %+v", stats)
+	}
+}
+
+func TestJitterBufferReordersAcrossWraparound(t *testing.T) {
+	b := newJitterBuffer()
+
+	pushFrames(b, 65534, 2, 1, 3, 0)
+
+	for _, expected := range []uint16{65534, 65535, 0, 1} {
+		if seq := popSequence(t, b); seq != expected {
+			t.Fatalf("unexpected sequence: %d, expected %d", seq, expected)
+		}
+	}
+}
+
+func TestJitterBufferRecoversLostPacketWithFEC(t *testing.T) {
+	b := newJitterBuffer()
+
+	pushFrames(b, 0, 0, 1, 3, 4)
+
+	popSequence(t, b)
+	popSequence(t, b)
+
+	frame, ok := b.pop()
+
+	if !ok || frame.packet != nil || frame.fec == nil || frame.fec.SequenceNumber != 3 {
+		t.Fatalf("lost packet should be recovered with the next one: %v %v", ok, frame)
+	}
+
+	if seq := popSequence(t, b); seq != 3 {
+		t.Fatalf("unexpected sequence after the loss: %d", seq)
+	}
+
+	if stats := b.getStats(); stats.lost != 1 {
+		t.Fatalf("lost packet is not counted: %+v", stats)
+	}
+}
+
+func TestJitterBufferConcealsLossWithoutNextPacket(t *testing.T) {
+	b := newJitterBuffer()
+
+	pushFrames(b, 0, 0, 1, 4, 5)
+
+	popSequence(t, b)
+	popSequence(t, b)
+
+	frame, ok := b.pop()
+
+	if !ok || frame.packet != nil || frame.fec != nil {
+		t.Fatalf("lost packet should be concealed: %v %v", ok, frame)
+	}
+
+	frame, ok = b.pop()
+
+	if !ok || frame.packet != nil || frame.fec == nil || frame.fec.SequenceNumber != 4 {
+		t.Fatalf("lost packet should be recovered with the next one: %v %v", ok, frame)
+	}
+
+	if stats := b.getStats(); stats.lost != 2 {
+		t.Fatalf("lost packets are not counted: %+v", stats)
+	}
+}
+
+func TestPlayerCountsRecoveredAndConcealedFrames(t *testing.T) {
+	b := newJitterBuffer()
+
+	pushFrames(b, 0, 0, 1, 4, 5)
+
+	p := newTestPlayer(t, b)
+
+	for p.decodeNext() {
+	}
+
+	if p.recovered != 1 || p.concealed != 1 {
+		t.Fatalf("unexpected recovered %d and concealed %d frames", p.recovered, p.concealed)
+	}
+}
+
+func TestJitterBufferDropsOldestPacketsOnOverflow(t *testing.T) {
+	b := newJitterBuffer()
+
+	frames := make([]int, 20)
+
+	for i := range frames {
+		frames[i] = i
+	}
+
+	pushFrames(b, 100, frames...)
+
+	// 19 frames are 18240 samples, only 15 frames fit into the maximum delay
+	if stats := b.getStats(); stats.overflowed != 4 {
+		t.Fatalf("unexpected overflowed packets: %+v", stats)
+	}
+
+	if seq := popSequence(t, b); seq != 104 {
+		t.Fatalf("playback should start from the oldest kept packet: %d", seq)
+	}
+
+	pushFrames(b, 100, 20, 21)
+
+	// the playback skips the dropped packet instead of concealing it
+	if seq := popSequence(t, b); seq != 106 {
+		t.Fatalf("playback should skip the dropped packets: %d", seq)
+	}
+}
+
+func TestPlayerPlaysSilenceOnUnderrun(t *testing.T) {
+	b := newJitterBuffer()
+
+	pushFrames(b, 0, 0, 1, 2, 3)
+
+	p := newTestPlayer(t, b)
+
+	samples := make([][2]float64, frameSamples*5)
+
+	for i := range samples {
+		samples[i] = [2]float64{1, 1}
+	}
+
+	n, ok := p.stream(samples)
+
+	if n != len(samples) || !ok {
+		t.Fatalf("stream should continue on underrun: %d %v", n, ok)
+	}
+
+	for i := frameSamples * 4; i < len(samples); i++ {
+		if samples[i] != [2]float64{0, 0} {
+			t.Fatalf("silence is not played on underrun: %d %v", i, samples[i])
+		}
+	}
+
+	if stats := b.getStats(); stats.underruns != 1 {
+		t.Fatalf("underrun is not counted: %+v", stats)
+	}
+
+	if _, ok := b.pop(); ok {
+		t.Fatal("playback should wait for the target delay after underrun")
+	}
+}
+
+func TestJitterBufferDrainsAfterEnd(t *testing.T) {
+	b := newJitterBuffer()
+
+	pushFrames(b, 0, 0, 1)
+
+	if _, ok := b.pop(); ok {
+		t.Fatal("playback should wait for the target delay")
+	}
+
+	b.end()
+
+	if b.isDrained() {
+		t.Fatal("buffer with packets should not be drained")
+	}
+
+	p := newTestPlayer(t, b)
+
+	samples := make([][2]float64, frameSamples)
+
+	for i := 0; i < 2; i++ {
+		if _, ok := p.stream(samples); !ok {
+			t.Fatalf("rest of the packets should be played: %d", i)
+		}
+	}
+
+	if !b.isDrained() {
+		t.Fatal("buffer should be drained")
+	}
+
+	if n, ok := p.stream(samples); n != 0 || ok {
+		t.Fatalf("stream should end when drained: %d %v", n, ok)
+	}
+}
@@ -0,0 +1,43 @@
+package botcom
+
+import "fmt"
+
+const (
+	// ModeManual - operator controls are passed to the robot
+	ModeManual = "manual"
+	// ModeAutonomous - robot drives itself, operator controls are held back unless override is pressed
+	ModeAutonomous = "autonomous"
+	// ModeShared - operator controls are passed to the robot to be blended with autonomous behaviour
+	ModeShared = "shared"
+
+	// ModeSourceOperator - mode switched from the Client App
+	ModeSourceOperator = "operator"
+	// ModeSourceRobot - mode switched by the robot, e.g. handover to manual
+	ModeSourceRobot = "robot"
+	// ModeSourceSession - current mode reported on the data channel opening
+	ModeSourceSession = "session"
+)
+
+type ModeChange struct {
+	Mode   string
+	Source string
+}
+
+func IsValidMode(mode string) bool {
+	return mode == ModeManual || mode == ModeAutonomous || mode == ModeShared
+}
+
+func BuildModeChangeMessage(mode string, source string) string {
+	return fmt.Sprintf("{\"type\": \"MODE_CHANGE\", \"payload\": {\"mode\": \"%s\", \"source\": \"%s\"}}", mode, source)
+}
+
+// SendMode notifies the robot about the mode transition
+func SendMode(botCommandsWriteChan chan string, id int, mode string) {
+	command := fmt.Sprintf("{\"address\":%d,\"controls\":{\"mode\":\"%s\"}}", id, mode)
+	botCommandsWriteChan <- command
+}
+
+func sendOverride(botCommandsWriteChan chan string, id int, state bool) {
+	command := fmt.Sprintf("{\"address\":%d,\"controls\":{\"override\":%t}}", id, state)
+	botCommandsWriteChan <- command
+}
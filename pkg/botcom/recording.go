@@ -0,0 +1,64 @@
+package botcom
+
+import (
+	"encoding/json"
+
+	"github.com/pion/webrtc/v3"
+	"github.com/roboportal/bot_box/pkg/recorder"
+)
+
+func buildRecordingMessage(recording *recorder.Recording) string {
+	type aPayload struct {
+		Active bool   `json:"active"`
+		Name   string `json:"name,omitempty"`
+	}
+
+	type aMessage struct {
+		Type    string   `json:"type"`
+		Payload aPayload `json:"payload"`
+	}
+
+	payload := aPayload{}
+
+	if recording != nil {
+		payload = aPayload{Active: true, Name: recording.Name}
+	}
+
+	message, _ := json.Marshal(aMessage{Type: "RECORDING", Payload: payload})
+
+	return string(message)
+}
+
+// nameRecordedTrack names the recorded files of the sender after the track
+func nameRecordedTrack(tap *recorder.Tap, sender *webrtc.RTPSender, name string) {
+	if tap == nil {
+		return
+	}
+
+	for _, encoding := range sender.GetParameters().Encodings {
+		tap.SetTrackName(uint32(encoding.SSRC), name)
+	}
+}
+
+// drainTrack reads the incoming track which is not played, so its packets reach the recorder
+func drainTrack(track *webrtc.TrackRemote) {
+	for {
+		_, _, err := track.ReadRTP()
+
+		if err != nil {
+			return
+		}
+	}
+}
+
+func getMessageType(message string) string {
+	type aMessage struct {
+		Type string
+	}
+
+	var data aMessage
+
+	json.Unmarshal([]byte(message), &data)
+
+	return data.Type
+}
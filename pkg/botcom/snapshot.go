@@ -0,0 +1,165 @@
+package botcom
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/roboportal/bot_box/pkg/snapshot"
+)
+
+// snapshotChunkSize keeps base64 encoded chunk well below the data channel message size limit
+const snapshotChunkSize = 32 * 1024
+
+type snapshotRequest struct {
+	// Camera name, the first camera is used when empty
+	Camera  string `json:"camera"`
+	Format  string `json:"format"`
+	Quality int    `json:"quality"`
+}
+
+func findSnapshotSource(cameras []Camera, name string) (string, snapshot.Source, error) {
+	for _, camera := range cameras {
+		if name != "" && camera.Name != name {
+			continue
+		}
+
+		source, ok := camera.Track.(snapshot.Source)
+
+		if !ok {
+			return camera.Name, nil, fmt.Errorf("raw frames are not available for camera: %s", camera.Name)
+		}
+
+		return camera.Name, source, nil
+	}
+
+	return name, nil, fmt.Errorf("unknown camera: %s", name)
+}
+
+func sendSnapshotMessage(sendDataChan chan string, msgType string, payload interface{}) {
+	message, err := json.Marshal(payload)
+
+	if err != nil {
+		log.Println("Serialize snapshot message error", err)
+		return
+	}
+
+	sendDataChan <- fmt.Sprintf("{\"type\": \"%s\", \"payload\": %s}", msgType, message)
+}
+
+// takeSnapshot captures the current frame and sends it to the Client App as 'SNAPSHOT_START'
+// followed by base64 encoded 'SNAPSHOT_CHUNK' messages
+func takeSnapshot(p InitParams, request snapshotRequest) {
+	type aStartPayload struct {
+		ID     string `json:"id"`
+		Camera string `json:"camera"`
+		Format string `json:"format"`
+		Width  int    `json:"width"`
+		Height int    `json:"height"`
+		Size   int    `json:"size"`
+		Chunks int    `json:"chunks"`
+	}
+
+	type aChunkPayload struct {
+		ID    string `json:"id"`
+		Index int    `json:"index"`
+		Data  string `json:"data"`
+	}
+
+	type anErrorPayload struct {
+		Camera string `json:"camera"`
+		Reason string `json:"reason"`
+	}
+
+	format := p.Snapshot.Format
+	quality := p.Snapshot.Quality
+
+	if request.Format != "" {
+		format = request.Format
+	}
+
+	if request.Quality > 0 && request.Quality <= 100 {
+		quality = request.Quality
+	}
+
+	fail := func(camera string, err error) {
+		log.Println("Snapshot error:", p.Id, camera, err)
+		sendSnapshotMessage(p.SendDataChan, "SNAPSHOT_ERROR", anErrorPayload{Camera: camera, Reason: err.Error()})
+	}
+
+	camera, source, err := findSnapshotSource(p.Cameras, request.Camera)
+
+	if err != nil {
+		fail(camera, err)
+		return
+	}
+
+	if !snapshot.IsValidFormat(format) {
+		fail(camera, fmt.Errorf("unknown snapshot format: %s", format))
+		return
+	}
+
+	now := time.Now()
+	img, err := snapshot.Capture(source)
+
+	if err != nil {
+		fail(camera, err)
+		return
+	}
+
+	data, err := snapshot.Encode(img, format, quality)
+
+	if err != nil {
+		fail(camera, err)
+		return
+	}
+
+	bounds := img.Bounds()
+
+	if p.Snapshot.Directory != "" {
+		name, err := snapshot.Save(p.Snapshot.Directory, data, snapshot.Metadata{
+			Time:      now,
+			BotID:     p.Id,
+			Camera:    camera,
+			Format:    format,
+			Width:     bounds.Dx(),
+			Height:    bounds.Dy(),
+			Telemetry: p.GetTelemetry(),
+		})
+
+		if err != nil {
+			log.Println("Save snapshot error:", p.Id, err)
+		} else {
+			log.Println("Snapshot saved:", p.Id, name)
+		}
+	}
+
+	id := fmt.Sprintf("%d", now.UnixNano())
+	chunks := (len(data) + snapshotChunkSize - 1) / snapshotChunkSize
+
+	sendSnapshotMessage(p.SendDataChan, "SNAPSHOT_START", aStartPayload{
+		ID:     id,
+		Camera: camera,
+		Format: format,
+		Width:  bounds.Dx(),
+		Height: bounds.Dy(),
+		Size:   len(data),
+		Chunks: chunks,
+	})
+
+	for i := 0; i < chunks; i++ {
+		end := (i + 1) * snapshotChunkSize
+
+		if end > len(data) {
+			end = len(data)
+		}
+
+		sendSnapshotMessage(p.SendDataChan, "SNAPSHOT_CHUNK", aChunkPayload{
+			ID:    id,
+			Index: i,
+			Data:  base64.StdEncoding.EncodeToString(data[i*snapshotChunkSize : end]),
+		})
+	}
+}
@@ -3,65 +3,196 @@ package botcom
 import (
 	"io"
 	"log"
+	"time"
 
 	"github.com/faiface/beep"
 	"github.com/pion/webrtc/v3"
 	"gopkg.in/hraban/opus.v2"
 )
 
-func Sound(track *webrtc.TrackRemote) beep.Streamer {
-	decoder, err := opus.NewDecoder(48000, 1)
+const (
+	// defaultFrameSize of 20ms Opus frames is concealed until the first packet is decoded
+	defaultFrameSize = 960
+	// maxFrameSize of 120ms Opus frames
+	maxFrameSize = 5760
 
-	if err != nil {
-		log.Println("opus.NewDecoder error", err)
+	pumpInterval = 20 * time.Millisecond
+)
+
+// aPlayer decodes the frames of the jitter buffer, the lost packets are recovered with in-band FEC of the following
+// packet or concealed by the decoder, silence is played on underrun
+type aPlayer struct {
+	buffer            *jitterBuffer
+	decoder           *opus.Decoder
+	pcm               []float32
+	frame             []float32
+	frameSize         int
+	expectedTimestamp uint32
+	hasTimestamp      bool
+	concealed         int
+	recovered         int
+}
+
+func (p *aPlayer) decodeNext() bool {
+	frame, ok := p.buffer.pop()
+
+	if !ok {
+		// the gap of the underrun is already filled with silence
+		p.hasTimestamp = false
+		return false
 	}
 
-	tmp := make([]float32, 8192)
+	if frame.packet == nil {
+		pcm := p.frame[:p.frameSize]
 
-	tmpCount := 0
+		var err error
 
-	return beep.StreamerFunc(func(samples [][2]float64) (n int, ok bool) {
+		if frame.fec != nil {
+			err = p.decoder.DecodeFECFloat32(frame.fec.Payload, pcm)
+			p.recovered++
+		} else {
+			err = p.decoder.DecodePLCFloat32(pcm)
+			p.concealed++
+		}
 
-		if tmpCount < len(samples) {
-			data, _, err := track.ReadRTP()
+		if err != nil {
+			log.Println("Conceal lost audio error", err)
 
-			if data == nil {
-				return 0, false
+			for i := range pcm {
+				pcm[i] = 0
 			}
+		}
+
+		p.pcm = append(p.pcm, pcm...)
+		p.expectedTimestamp += uint32(p.frameSize)
+
+		return true
+	}
+
+	// the sender does not send packets during the silence with DTX, the gap is filled with silence
+	if p.hasTimestamp {
+		gap := int32(frame.packet.Timestamp - p.expectedTimestamp)
+
+		if gap > 0 && gap <= opusSampleRate {
+			p.pcm = append(p.pcm, make([]float32, gap)...)
+		}
+	}
+
+	n, err := p.decoder.DecodeFloat32(frame.packet.Payload, p.frame)
+
+	if err != nil {
+		log.Println("Decode error", err)
+
+		n = p.frameSize
+
+		for i := range p.frame[:n] {
+			p.frame[i] = 0
+		}
+	}
+
+	p.frameSize = n
+	p.pcm = append(p.pcm, p.frame[:n]...)
+	p.expectedTimestamp = frame.packet.Timestamp + uint32(n)
+	p.hasTimestamp = true
+
+	return true
+}
+
+func (p *aPlayer) stream(samples [][2]float64) (int, bool) {
+	for len(p.pcm) < len(samples) {
+		if !p.decodeNext() {
+			break
+		}
+	}
+
+	if len(p.pcm) == 0 && p.buffer.isDrained() {
+		stats := p.buffer.getStats()
+
+		log.Println("Operator audio ended, received:", stats.received, "lost:", stats.lost, "recovered:", p.recovered,
+			"concealed:", p.concealed, "late:", stats.late, "overflowed:", stats.overflowed, "underruns:", stats.underruns)
+
+		return 0, false
+	}
+
+	n := len(p.pcm)
+
+	if n > len(samples) {
+		n = len(samples)
+	}
+
+	for i := range samples {
+		value := 0.0
+
+		if i < n {
+			value = float64(p.pcm[i])
+		}
+
+		samples[i][0] = value
+		samples[i][1] = value
+	}
+
+	p.pcm = append(p.pcm[:0], p.pcm[n:]...)
+
+	return len(samples), true
+}
+
+// Sound plays the operator audio track, the packets are read in the background into the jitter buffer
+func Sound(track *webrtc.TrackRemote) beep.Streamer {
+	decoder, err := opus.NewDecoder(opusSampleRate, 1)
+
+	if err != nil {
+		log.Println("opus.NewDecoder error", err)
+		return beep.Silence(0)
+	}
+
+	buffer := newJitterBuffer()
+
+	go func() {
+		defer buffer.end()
+
+		for {
+			packet, _, err := track.ReadRTP()
 
 			if err == io.EOF {
-				return 0, false
+				return
 			}
 
 			if err != nil {
 				log.Println("Stream fn error", err)
-				return 0, false
+				return
 			}
 
-			pcm := make([]float32, 8192)
-
-			n, err = decoder.DecodeFloat32(data.Payload, pcm)
+			buffer.push(packet)
+		}
+	}()
+
+	p := &aPlayer{
+		buffer:    buffer,
+		decoder:   decoder,
+		pcm:       make([]float32, 0, maxFrameSize*2),
+		frame:     make([]float32, maxFrameSize),
+		frameSize: defaultFrameSize,
+	}
 
-			if err != nil {
-				log.Println("Decode error", err)
-			}
+	return beep.StreamerFunc(p.stream)
+}
 
-			tmp = append(tmp, pcm...)
-			tmpCount += n
-		}
+// pumpAudio streams the operator audio in real time when it is not pulled by the speaker, e.g. to the audio sink
+func pumpAudio(streamer beep.Streamer, done chan bool) {
+	ticker := time.NewTicker(pumpInterval)
+	defer ticker.Stop()
 
-		for i := range samples {
-			samples[i][0] = float64(tmp[i])
-			samples[i][1] = float64(tmp[i])
-		}
+	samples := make([][2]float64, opusSampleRate*int(pumpInterval/time.Millisecond)/1000)
 
-		tmp = tmp[len(samples):tmpCount]
-		tmpCount -= len(samples)
+	for {
+		select {
+		case <-done:
+			return
 
-		if tmpCount < 0 {
-			tmpCount = 0
+		case <-ticker.C:
+			if _, ok := streamer.Stream(samples); !ok {
+				return
+			}
 		}
-
-		return len(samples), true
-	})
-}
\ No newline at end of file
+	}
+}
@@ -0,0 +1,24 @@
+package botcom
+
+import (
+	"time"
+
+	"github.com/pion/webrtc/v3"
+)
+
+// getRoundTripTime returns RTT of the selected candidate pair
+func getRoundTripTime(peerConnection *webrtc.PeerConnection) (time.Duration, bool) {
+	for _, s := range peerConnection.GetStats() {
+		pair, ok := s.(webrtc.ICECandidatePairStats)
+
+		if !ok || !pair.Nominated || pair.State != webrtc.StatsICECandidatePairStateSucceeded {
+			continue
+		}
+
+		if pair.CurrentRoundTripTime > 0 {
+			return time.Duration(pair.CurrentRoundTripTime * float64(time.Second)), true
+		}
+	}
+
+	return 0, false
+}
@@ -0,0 +1,58 @@
+// Package broadcast publishes the robot media to standard media servers with WHIP and serves it to standard players
+// on the LAN with WHEP, independently of the RoboPortal sessions
+package broadcast
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/pion/webrtc/v3"
+)
+
+const (
+	sdpContentType = "application/sdp"
+
+	// gatheringTimeout limits waiting for the candidates, the SDP is exchanged once without trickle ICE
+	gatheringTimeout = 10 * time.Second
+)
+
+// Source of the broadcast peer connections
+type Source struct {
+	Api              *webrtc.API
+	GetConfiguration func() webrtc.Configuration
+	// Tracks are published in every broadcast peer connection, a video track and the audio
+	Tracks []webrtc.TrackLocal
+}
+
+func addTracks(peerConnection *webrtc.PeerConnection, tracks []webrtc.TrackLocal) error {
+	for _, track := range tracks {
+		_, err := peerConnection.AddTransceiverFromTrack(track, webrtc.RtpTransceiverInit{
+			Direction: webrtc.RTPTransceiverDirectionSendonly,
+		})
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// setLocalDescription applies the description and waits for all the candidates to be added to it
+func setLocalDescription(peerConnection *webrtc.PeerConnection, description webrtc.SessionDescription) (string, error) {
+	isGatheringComplete := webrtc.GatheringCompletePromise(peerConnection)
+
+	err := peerConnection.SetLocalDescription(description)
+
+	if err != nil {
+		return "", err
+	}
+
+	select {
+	case <-isGatheringComplete:
+	case <-time.After(gatheringTimeout):
+		return "", fmt.Errorf("ICE gathering timeout")
+	}
+
+	return peerConnection.LocalDescription().SDP, nil
+}
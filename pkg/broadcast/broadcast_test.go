@@ -0,0 +1,321 @@
+package broadcast
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pion/ice/v3"
+	"github.com/pion/webrtc/v3"
+	"github.com/pion/webrtc/v3/pkg/media"
+)
+
+const testToken = "secret"
+
+// newTestAPI gathers only the loopback candidates, so the peers connect without the network
+func newTestAPI(t *testing.T) *webrtc.API {
+	mediaEngine := &webrtc.MediaEngine{}
+
+	err := mediaEngine.RegisterDefaultCodecs()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	settingEngine := webrtc.SettingEngine{}
+	settingEngine.SetIncludeLoopbackCandidate(true)
+	settingEngine.SetNetworkTypes([]webrtc.NetworkType{webrtc.NetworkTypeUDP4})
+	settingEngine.SetICEMulticastDNSMode(ice.MulticastDNSModeDisabled)
+
+	return webrtc.NewAPI(webrtc.WithMediaEngine(mediaEngine), webrtc.WithSettingEngine(settingEngine))
+}
+
+// newTestSource publishes a video track fed with VP8 samples until the test ends
+func newTestSource(t *testing.T, api *webrtc.API) Source {
+	track, err := webrtc.NewTrackLocalStaticSample(webrtc.RTPCodecCapability{MimeType: webrtc.MimeTypeVP8}, "video", "bot")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan struct{})
+	t.Cleanup(func() { close(done) })
+
+	go func() {
+		ticker := time.NewTicker(33 * time.Millisecond)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+
+			case <-ticker.C:
+				track.WriteSample(media.Sample{Data: []byte{0x10, 0x02, 0x00, 0x9d, 0x01, 0x2a}, Duration: 33 * time.Millisecond})
+			}
+		}
+	}()
+
+	return Source{
+		Api:              api,
+		GetConfiguration: func() webrtc.Configuration { return webrtc.Configuration{} },
+		Tracks:           []webrtc.TrackLocal{track},
+	}
+}
+
+// newPeer returns a receiving peer connection, the channel is closed when the first RTP packet of the video is read
+func newPeer(t *testing.T, api *webrtc.API) (*webrtc.PeerConnection, chan struct{}) {
+	peerConnection, err := api.NewPeerConnection(webrtc.Configuration{})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { peerConnection.Close() })
+
+	received := make(chan struct{})
+	var once sync.Once
+
+	peerConnection.OnTrack(func(track *webrtc.TrackRemote, _ *webrtc.RTPReceiver) {
+		_, _, err := track.ReadRTP()
+
+		if err == nil && track.Kind() == webrtc.RTPCodecTypeVideo {
+			once.Do(func() { close(received) })
+		}
+	})
+
+	return peerConnection, received
+}
+
+func expectReceived(t *testing.T, received chan struct{}) {
+	select {
+	case <-received:
+	case <-time.After(10 * time.Second):
+		t.Fatal("video is not received")
+	}
+}
+
+// newWHIPServer is a local WHIP endpoint of a media server, it answers the offers of the publisher
+func newWHIPServer(t *testing.T, api *webrtc.API) (*httptest.Server, chan struct{}) {
+	peerConnection, received := newPeer(t, api)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer "+testToken {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		if r.Method == http.MethodDelete {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+
+		offer, _ := ioutil.ReadAll(r.Body)
+
+		err := peerConnection.SetRemoteDescription(webrtc.SessionDescription{Type: webrtc.SDPTypeOffer, SDP: string(offer)})
+
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		answer, err := peerConnection.CreateAnswer(nil)
+
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		sdp, err := setLocalDescription(peerConnection, answer)
+
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", sdpContentType)
+		w.Header().Set("Location", "/whip/session")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(sdp))
+	}))
+
+	t.Cleanup(server.Close)
+
+	return server, received
+}
+
+func TestWHIPPublishesToMediaServer(t *testing.T) {
+	api := newTestAPI(t)
+	server, received := newWHIPServer(t, api)
+
+	params := WHIPParams{URL: server.URL + "/whip", Token: testToken, ReconnectInterval: time.Second}
+	endpoint, _ := url.Parse(params.URL)
+
+	publisher := &aPublisher{
+		source:   newTestSource(t, api),
+		params:   params,
+		endpoint: endpoint,
+		client:   &http.Client{Timeout: whipRequestTimeout},
+	}
+
+	go publisher.publish()
+
+	expectReceived(t, received)
+}
+
+// newPlayer creates the receiving peer connection of a player and its offer with all the candidates
+func newPlayer(t *testing.T, api *webrtc.API) (*webrtc.PeerConnection, string, chan struct{}) {
+	peerConnection, received := newPeer(t, api)
+
+	_, err := peerConnection.AddTransceiverFromKind(webrtc.RTPCodecTypeVideo, webrtc.RTPTransceiverInit{
+		Direction: webrtc.RTPTransceiverDirectionRecvonly,
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	description, err := peerConnection.CreateOffer(nil)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sdp, err := setLocalDescription(peerConnection, description)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return peerConnection, sdp, received
+}
+
+// post sends the player offer, the status code, the session resource and the answer are returned
+func post(target string, token string, sdp string) (int, string, string, error) {
+	request, err := http.NewRequest(http.MethodPost, target+WHEPPath, strings.NewReader(sdp))
+
+	if err != nil {
+		return 0, "", "", err
+	}
+
+	request.Header.Set("Content-Type", sdpContentType)
+	request.Header.Set("Authorization", "Bearer "+token)
+
+	response, err := http.DefaultClient.Do(request)
+
+	if err != nil {
+		return 0, "", "", err
+	}
+
+	defer response.Body.Close()
+
+	answer, err := ioutil.ReadAll(response.Body)
+
+	return response.StatusCode, response.Header.Get("Location"), string(answer), err
+}
+
+func startWHEP(t *testing.T, maxViewers int) (*aServer, *httptest.Server, *webrtc.API) {
+	api := newTestAPI(t)
+	s := newServer(newTestSource(t, api), WHEPParams{Token: testToken, MaxViewers: maxViewers})
+
+	server := httptest.NewServer(s.handler())
+	t.Cleanup(server.Close)
+
+	return s, server, api
+}
+
+func TestWHEPServesPlayerAndEndsSession(t *testing.T) {
+	s, server, api := startWHEP(t, 0)
+
+	peerConnection, sdp, received := newPlayer(t, api)
+
+	status, location, answer, err := post(server.URL, testToken, sdp)
+
+	if err != nil || status != http.StatusCreated {
+		t.Fatalf("unexpected status: %d %v", status, err)
+	}
+
+	err = peerConnection.SetRemoteDescription(webrtc.SessionDescription{Type: webrtc.SDPTypeAnswer, SDP: answer})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expectReceived(t, received)
+
+	request, _ := http.NewRequest(http.MethodDelete, server.URL+location, nil)
+	request.Header.Set("Authorization", "Bearer "+testToken)
+
+	response, err := http.DefaultClient.Do(request)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		t.Fatalf("unexpected delete status: %d", response.StatusCode)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.sessions) != 0 {
+		t.Fatalf("session is not removed: %d", len(s.sessions))
+	}
+}
+
+func TestWHEPRejectsUnauthorizedPlayer(t *testing.T) {
+	_, server, api := startWHEP(t, 0)
+
+	_, sdp, _ := newPlayer(t, api)
+
+	status, _, _, err := post(server.URL, "wrong", sdp)
+
+	if err != nil || status != http.StatusUnauthorized {
+		t.Fatalf("unexpected status: %d", status)
+	}
+}
+
+func TestWHEPLimitsConcurrentViewers(t *testing.T) {
+	s, server, api := startWHEP(t, 2)
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	statuses := make(map[int]int)
+
+	for i := 0; i < 6; i++ {
+		_, sdp, _ := newPlayer(t, api)
+
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			status, _, _, _ := post(server.URL, testToken, sdp)
+
+			mu.Lock()
+			statuses[status]++
+			mu.Unlock()
+		}()
+	}
+
+	wg.Wait()
+
+	if statuses[http.StatusCreated] != 2 || statuses[http.StatusServiceUnavailable] != 4 {
+		t.Fatalf("unexpected statuses: %v", statuses)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.pending != 0 {
+		t.Fatalf("viewer slots are not released: %d", s.pending)
+	}
+}
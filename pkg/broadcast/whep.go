@@ -0,0 +1,277 @@
+package broadcast
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/pion/webrtc/v3"
+)
+
+const (
+	// WHEPPath of the endpoint, the sessions are 'WHEPPath/<id>' resources
+	WHEPPath = "/whep"
+
+	// maxOfferSize keeps the malformed requests from exhausting the memory
+	maxOfferSize = 64 * 1024
+)
+
+type WHEPParams struct {
+	// Address to listen on, e.g. ':8889', the endpoint is disabled when empty
+	Address string
+	// Token is required as 'Authorization: Bearer' header from the players when set
+	Token string
+	// MaxViewers limits the number of simultaneous sessions to spare the CPU and the uplink, 0 - unlimited
+	MaxViewers int
+}
+
+func (p WHEPParams) Validate() error {
+	if p.MaxViewers < 0 {
+		return fmt.Errorf("WHEP max viewers should not be negative: %d", p.MaxViewers)
+	}
+
+	return nil
+}
+
+type aServer struct {
+	mu       sync.Mutex
+	source   Source
+	params   WHEPParams
+	sessions map[string]*webrtc.PeerConnection
+	// pending sessions are counted as viewers while their candidates are gathered
+	pending int
+}
+
+func newServer(source Source, p WHEPParams) *aServer {
+	return &aServer{
+		source:   source,
+		params:   p,
+		sessions: make(map[string]*webrtc.PeerConnection),
+	}
+}
+
+// Serve starts the WHEP endpoint serving the tracks to the players
+func Serve(source Source, p WHEPParams) {
+	s := newServer(source, p)
+
+	go func() {
+		log.Println("Serving WHEP on:", p.Address+WHEPPath)
+
+		err := http.ListenAndServe(p.Address, s.handler())
+
+		log.Println("WHEP server error", err)
+	}()
+}
+
+func (s *aServer) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc(WHEPPath, s.handleOffer)
+	mux.HandleFunc(WHEPPath+"/", s.handleSession)
+
+	return mux
+}
+
+func generateID() string {
+	data := make([]byte, 8)
+	rand.Read(data)
+
+	return hex.EncodeToString(data)
+}
+
+// setHeaders allows the players served from other origins
+func setHeaders(w http.ResponseWriter) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Methods", "POST, DELETE, OPTIONS")
+	w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type")
+	w.Header().Set("Access-Control-Expose-Headers", "Location")
+}
+
+func (s *aServer) isAuthorized(r *http.Request) bool {
+	return s.params.Token == "" || r.Header.Get("Authorization") == "Bearer "+s.params.Token
+}
+
+// reserveViewer takes the slot of a new session, false is returned when there are too many viewers
+func (s *aServer) reserveViewer() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	viewers := len(s.sessions) + s.pending
+
+	if s.params.MaxViewers > 0 && viewers >= s.params.MaxViewers {
+		log.Println("WHEP session rejected, too many viewers:", viewers)
+		return false
+	}
+
+	s.pending++
+
+	return true
+}
+
+func (s *aServer) releaseViewer() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.pending--
+}
+
+func (s *aServer) removeSession(id string) {
+	s.mu.Lock()
+	peerConnection, ok := s.sessions[id]
+	delete(s.sessions, id)
+	s.mu.Unlock()
+
+	if ok {
+		log.Println("WHEP session closed:", id)
+		peerConnection.Close()
+	}
+}
+
+// answer creates a session for the offer of a player and returns its id and the answer
+func (s *aServer) answer(offer string) (string, string, error) {
+	peerConnection, err := s.source.Api.NewPeerConnection(s.source.GetConfiguration())
+
+	if err != nil {
+		return "", "", err
+	}
+
+	id := generateID()
+
+	peerConnection.OnConnectionStateChange(func(state webrtc.PeerConnectionState) {
+		log.Println("WHEP connection state has changed:", id, state)
+
+		if state == webrtc.PeerConnectionStateFailed || state == webrtc.PeerConnectionStateClosed {
+			s.removeSession(id)
+		}
+	})
+
+	fail := func(err error) (string, string, error) {
+		peerConnection.Close()
+		return "", "", err
+	}
+
+	err = addTracks(peerConnection, s.source.Tracks)
+
+	if err != nil {
+		return fail(err)
+	}
+
+	err = peerConnection.SetRemoteDescription(webrtc.SessionDescription{Type: webrtc.SDPTypeOffer, SDP: offer})
+
+	if err != nil {
+		return fail(err)
+	}
+
+	answer, err := peerConnection.CreateAnswer(nil)
+
+	if err != nil {
+		return fail(err)
+	}
+
+	sdp, err := setLocalDescription(peerConnection, answer)
+
+	if err != nil {
+		return fail(err)
+	}
+
+	s.mu.Lock()
+	s.sessions[id] = peerConnection
+	s.mu.Unlock()
+
+	return id, sdp, nil
+}
+
+func (s *aServer) handleOffer(w http.ResponseWriter, r *http.Request) {
+	setHeaders(w)
+
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST, OPTIONS")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !s.isAuthorized(r) {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	if !strings.HasPrefix(r.Header.Get("Content-Type"), sdpContentType) {
+		w.WriteHeader(http.StatusUnsupportedMediaType)
+		return
+	}
+
+	if !s.reserveViewer() {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+
+	// the slot is taken by the session itself once it is created
+	defer s.releaseViewer()
+
+	offer, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxOfferSize))
+
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	id, answer, err := s.answer(string(offer))
+
+	if err != nil {
+		log.Println("WHEP session error", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	log.Println("WHEP session created:", id, r.RemoteAddr)
+
+	w.Header().Set("Content-Type", sdpContentType)
+	w.Header().Set("Location", WHEPPath+"/"+id)
+	w.WriteHeader(http.StatusCreated)
+	w.Write([]byte(answer))
+}
+
+// handleSession ends the session, trickle ICE is not supported as the answer has all the candidates
+func (s *aServer) handleSession(w http.ResponseWriter, r *http.Request) {
+	setHeaders(w)
+
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	if r.Method != http.MethodDelete {
+		w.Header().Set("Allow", "DELETE, OPTIONS")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !s.isAuthorized(r) {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	id := strings.TrimPrefix(r.URL.Path, WHEPPath+"/")
+
+	s.mu.Lock()
+	_, ok := s.sessions[id]
+	s.mu.Unlock()
+
+	if !ok {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	s.removeSession(id)
+
+	w.WriteHeader(http.StatusOK)
+}
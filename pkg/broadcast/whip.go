@@ -0,0 +1,231 @@
+package broadcast
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/pion/webrtc/v3"
+)
+
+// whipRequestTimeout limits the HTTP requests to the WHIP endpoint
+const whipRequestTimeout = 10 * time.Second
+
+type WHIPParams struct {
+	// URL of the WHIP endpoint, publishing is disabled when empty
+	URL string
+	// Token is sent as 'Authorization: Bearer' header when set
+	Token string
+	// ReconnectInterval is the pause before publishing again after a failure
+	ReconnectInterval time.Duration
+}
+
+func (p WHIPParams) Validate() error {
+	if p.URL == "" {
+		return nil
+	}
+
+	endpoint, err := url.Parse(p.URL)
+
+	if err != nil {
+		return err
+	}
+
+	if endpoint.Scheme != "http" && endpoint.Scheme != "https" {
+		return fmt.Errorf("WHIP URL should be http or https: %s", p.URL)
+	}
+
+	if p.ReconnectInterval <= 0 {
+		return fmt.Errorf("WHIP reconnect interval should be positive: %s", p.ReconnectInterval)
+	}
+
+	return nil
+}
+
+type aPublisher struct {
+	source   Source
+	params   WHIPParams
+	endpoint *url.URL
+	client   *http.Client
+}
+
+// Publish keeps the tracks published to the WHIP endpoint, the session is created again after every failure
+func Publish(source Source, p WHIPParams) {
+	endpoint, err := url.Parse(p.URL)
+
+	if err != nil {
+		log.Println("Parse WHIP URL error", err)
+		return
+	}
+
+	publisher := &aPublisher{
+		source:   source,
+		params:   p,
+		endpoint: endpoint,
+		client:   &http.Client{Timeout: whipRequestTimeout},
+	}
+
+	go publisher.run()
+}
+
+func (p *aPublisher) run() {
+	for {
+		err := p.publish()
+
+		if err != nil {
+			log.Println("WHIP publish error", err)
+		}
+
+		log.Println("WHIP publishing again in", p.params.ReconnectInterval)
+
+		time.Sleep(p.params.ReconnectInterval)
+	}
+}
+
+func (p *aPublisher) newRequest(method string, target string, body string) (*http.Request, error) {
+	request, err := http.NewRequest(method, target, strings.NewReader(body))
+
+	if err != nil {
+		return nil, err
+	}
+
+	if body != "" {
+		request.Header.Set("Content-Type", sdpContentType)
+	}
+
+	if p.params.Token != "" {
+		request.Header.Set("Authorization", "Bearer "+p.params.Token)
+	}
+
+	return request, nil
+}
+
+// post sends the offer, the answer and the URL of the created session resource are returned
+func (p *aPublisher) post(offer string) (string, string, error) {
+	request, err := p.newRequest(http.MethodPost, p.endpoint.String(), offer)
+
+	if err != nil {
+		return "", "", err
+	}
+
+	response, err := p.client.Do(request)
+
+	if err != nil {
+		return "", "", err
+	}
+
+	defer response.Body.Close()
+
+	body, err := ioutil.ReadAll(response.Body)
+
+	if err != nil {
+		return "", "", err
+	}
+
+	if response.StatusCode != http.StatusCreated && response.StatusCode != http.StatusOK {
+		return "", "", fmt.Errorf("WHIP endpoint responded with %s: %s", response.Status, strings.TrimSpace(string(body)))
+	}
+
+	location := response.Header.Get("Location")
+
+	if location == "" {
+		return string(body), "", nil
+	}
+
+	resource, err := p.endpoint.Parse(location)
+
+	if err != nil {
+		return "", "", err
+	}
+
+	return string(body), resource.String(), nil
+}
+
+// delete ends the session on the media server, the errors are only logged as the session is abandoned anyway
+func (p *aPublisher) delete(resource string) {
+	if resource == "" {
+		return
+	}
+
+	request, err := p.newRequest(http.MethodDelete, resource, "")
+
+	if err != nil {
+		log.Println("WHIP delete error", err)
+		return
+	}
+
+	response, err := p.client.Do(request)
+
+	if err != nil {
+		log.Println("WHIP delete error", err)
+		return
+	}
+
+	response.Body.Close()
+}
+
+// publish creates a session and blocks until it fails
+func (p *aPublisher) publish() error {
+	peerConnection, err := p.source.Api.NewPeerConnection(p.source.GetConfiguration())
+
+	if err != nil {
+		return err
+	}
+
+	defer peerConnection.Close()
+
+	isFailed := make(chan webrtc.PeerConnectionState, 1)
+
+	peerConnection.OnConnectionStateChange(func(state webrtc.PeerConnectionState) {
+		log.Println("WHIP connection state has changed:", state)
+
+		if state == webrtc.PeerConnectionStateFailed || state == webrtc.PeerConnectionStateClosed {
+			select {
+			case isFailed <- state:
+			default:
+			}
+		}
+	})
+
+	err = addTracks(peerConnection, p.source.Tracks)
+
+	if err != nil {
+		return err
+	}
+
+	offer, err := peerConnection.CreateOffer(nil)
+
+	if err != nil {
+		return err
+	}
+
+	sdp, err := setLocalDescription(peerConnection, offer)
+
+	if err != nil {
+		return err
+	}
+
+	answer, resource, err := p.post(sdp)
+
+	if err != nil {
+		return err
+	}
+
+	defer p.delete(resource)
+
+	err = peerConnection.SetRemoteDescription(webrtc.SessionDescription{Type: webrtc.SDPTypeAnswer, SDP: answer})
+
+	if err != nil {
+		return err
+	}
+
+	log.Println("WHIP session created:", resource)
+
+	state := <-isFailed
+
+	return fmt.Errorf("WHIP connection %s", state)
+}
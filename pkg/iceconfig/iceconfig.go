@@ -0,0 +1,143 @@
+// Package iceconfig keeps STUN and TURN servers of the peer connections, including time-limited TURN credentials
+// issued by the platform
+package iceconfig
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pion/webrtc/v3"
+)
+
+const (
+	PolicyAll   = "all"
+	PolicyRelay = "relay"
+
+	// minRefreshInterval keeps the platform from being flooded by credentials with a short TTL
+	minRefreshInterval = time.Minute
+)
+
+type Params struct {
+	StunURLs []string
+	// TurnURLs are turn: (UDP, or TCP with ?transport=tcp) and turns: (TLS) URLs sharing the credentials
+	TurnURLs       []string
+	TurnUsername   string
+	TurnCredential string
+	// TransportPolicy is 'all' or 'relay' to use TURN only
+	TransportPolicy string
+}
+
+type AnICEConfig struct {
+	mu              sync.Mutex
+	servers         []webrtc.ICEServer
+	platformServers []webrtc.ICEServer
+	transportPolicy webrtc.ICETransportPolicy
+}
+
+func cleanURLs(urls []string) []string {
+	result := make([]string, 0, len(urls))
+
+	for _, url := range urls {
+		url = strings.Trim(strings.TrimSpace(url), ",")
+
+		if url != "" {
+			result = append(result, url)
+		}
+	}
+
+	return result
+}
+
+func Factory(p Params) (*AnICEConfig, error) {
+	if p.TransportPolicy != "" && p.TransportPolicy != PolicyAll && p.TransportPolicy != PolicyRelay {
+		return nil, fmt.Errorf("unknown ICE transport policy: %s", p.TransportPolicy)
+	}
+
+	c := &AnICEConfig{
+		servers:         make([]webrtc.ICEServer, 0),
+		transportPolicy: webrtc.ICETransportPolicyAll,
+	}
+
+	if p.TransportPolicy == PolicyRelay {
+		c.transportPolicy = webrtc.ICETransportPolicyRelay
+	}
+
+	stunURLs := cleanURLs(p.StunURLs)
+
+	if len(stunURLs) > 0 {
+		c.servers = append(c.servers, webrtc.ICEServer{URLs: stunURLs})
+	}
+
+	turnURLs := cleanURLs(p.TurnURLs)
+
+	for _, url := range turnURLs {
+		if !strings.HasPrefix(url, "turn:") && !strings.HasPrefix(url, "turns:") {
+			return nil, fmt.Errorf("TURN URL should start with turn: or turns: %s", url)
+		}
+	}
+
+	if len(turnURLs) > 0 {
+		c.servers = append(c.servers, webrtc.ICEServer{
+			URLs:           turnURLs,
+			Username:       p.TurnUsername,
+			Credential:     p.TurnCredential,
+			CredentialType: webrtc.ICECredentialTypePassword,
+		})
+	}
+
+	return c, nil
+}
+
+// SetPlatformServers replaces the servers issued by the platform, the interval to request new credentials is returned,
+// zero for credentials without TTL.
+// The payload is {"iceServers": [{"urls": [...], "username": "...", "credential": "..."}], "ttl": 86400}
+func (c *AnICEConfig) SetPlatformServers(payload []byte) (time.Duration, error) {
+	type aPayload struct {
+		ICEServers []webrtc.ICEServer `json:"iceServers"`
+		// TTL of the credentials in seconds
+		TTL int `json:"ttl"`
+	}
+
+	var data aPayload
+
+	err := json.Unmarshal(payload, &data)
+
+	if err != nil {
+		return 0, err
+	}
+
+	c.mu.Lock()
+	c.platformServers = data.ICEServers
+	c.mu.Unlock()
+
+	if data.TTL <= 0 {
+		return 0, nil
+	}
+
+	// credentials are renewed halfway, so sessions started just before the expiry still could allocate
+	refreshIn := time.Duration(data.TTL) * time.Second / 2
+
+	if refreshIn < minRefreshInterval {
+		refreshIn = minRefreshInterval
+	}
+
+	return refreshIn, nil
+}
+
+// Configuration of a new peer connection
+func (c *AnICEConfig) Configuration() webrtc.Configuration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	servers := make([]webrtc.ICEServer, 0, len(c.servers)+len(c.platformServers))
+	servers = append(servers, c.servers...)
+	servers = append(servers, c.platformServers...)
+
+	return webrtc.Configuration{
+		ICEServers:         servers,
+		ICETransportPolicy: c.transportPolicy,
+	}
+}
@@ -0,0 +1,46 @@
+//go:build linux
+// +build linux
+
+package joystick
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+type absInfo struct {
+	Value      int32
+	Minimum    int32
+	Maximum    int32
+	Fuzz       int32
+	Flat       int32
+	Resolution int32
+}
+
+// eviocgabs builds EVIOCGABS(abs) ioctl request number
+func eviocgabs(code uint16) uintptr {
+	const (
+		iocRead      = 2
+		iocDirShift  = 30
+		iocTypeShift = 8
+		iocSizeShift = 16
+	)
+
+	size := unsafe.Sizeof(absInfo{})
+
+	return uintptr(iocRead<<iocDirShift) | uintptr('E')<<iocTypeShift | uintptr(0x40+code) | size<<iocSizeShift
+}
+
+// queryAxisRange asks the evdev driver for the axis range, ok is false for non-device files
+func queryAxisRange(f *os.File, code uint16) (min int32, max int32, ok bool) {
+	var info absInfo
+
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, f.Fd(), eviocgabs(code), uintptr(unsafe.Pointer(&info)))
+
+	if errno != 0 || info.Minimum == info.Maximum {
+		return 0, 0, false
+	}
+
+	return info.Minimum, info.Maximum, true
+}
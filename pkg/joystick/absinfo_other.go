@@ -0,0 +1,11 @@
+//go:build !linux
+// +build !linux
+
+package joystick
+
+import "os"
+
+// queryAxisRange is only supported by Linux evdev, ranges from the mapping are used instead
+func queryAxisRange(f *os.File, code uint16) (min int32, max int32, ok bool) {
+	return 0, 0, false
+}
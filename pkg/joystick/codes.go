@@ -0,0 +1,74 @@
+package joystick
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// Linux input event types, see linux/input-event-codes.h
+const (
+	evSyn = 0x00
+	evKey = 0x01
+	evAbs = 0x03
+
+	synReport = 0x00
+)
+
+var codeNames = map[string]uint16{
+	"ABS_X":     0x00,
+	"ABS_Y":     0x01,
+	"ABS_Z":     0x02,
+	"ABS_RX":    0x03,
+	"ABS_RY":    0x04,
+	"ABS_RZ":    0x05,
+	"ABS_GAS":   0x09,
+	"ABS_BRAKE": 0x0a,
+	"ABS_HAT0X": 0x10,
+	"ABS_HAT0Y": 0x11,
+
+	"BTN_TRIGGER": 0x120,
+	"BTN_THUMB":   0x121,
+	"BTN_THUMB2":  0x122,
+	"BTN_TOP":     0x123,
+	"BTN_TOP2":    0x124,
+	"BTN_PINKIE":  0x125,
+	"BTN_SOUTH":   0x130,
+	"BTN_A":       0x130,
+	"BTN_EAST":    0x131,
+	"BTN_B":       0x131,
+	"BTN_C":       0x132,
+	"BTN_NORTH":   0x133,
+	"BTN_X":       0x133,
+	"BTN_WEST":    0x134,
+	"BTN_Y":       0x134,
+	"BTN_Z":       0x135,
+	"BTN_TL":      0x136,
+	"BTN_TR":      0x137,
+	"BTN_TL2":     0x138,
+	"BTN_TR2":     0x139,
+	"BTN_SELECT":  0x13a,
+	"BTN_START":   0x13b,
+	"BTN_MODE":    0x13c,
+	"BTN_THUMBL":  0x13d,
+	"BTN_THUMBR":  0x13e,
+
+	"BTN_DPAD_UP":    0x220,
+	"BTN_DPAD_DOWN":  0x221,
+	"BTN_DPAD_LEFT":  0x222,
+	"BTN_DPAD_RIGHT": 0x223,
+}
+
+// parseCode accepts either a name from linux/input-event-codes.h or a numeric code
+func parseCode(code string) (uint16, error) {
+	if c, ok := codeNames[code]; ok {
+		return c, nil
+	}
+
+	c, err := strconv.ParseUint(code, 0, 16)
+
+	if err != nil {
+		return 0, fmt.Errorf("unknown input code %q", code)
+	}
+
+	return uint16(c), nil
+}
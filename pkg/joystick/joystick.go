@@ -0,0 +1,392 @@
+package joystick
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"math"
+	"os"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	// Override - local controller wins over remote operator while it is in use
+	Override = "override"
+	// Fallback - local controller is used only when there is no remote operator
+	Fallback = "fallback"
+)
+
+type AxisMapping struct {
+	Code      string  `json:"code"`
+	Key       string  `json:"key"`
+	Direction string  `json:"direction"`
+	Scale     float64 `json:"scale"`
+	Deadzone  float64 `json:"deadzone"`
+	Invert    bool    `json:"invert"`
+	Min       *int32  `json:"min"`
+	Max       *int32  `json:"max"`
+}
+
+type ButtonMapping struct {
+	Code     string          `json:"code"`
+	Key      string          `json:"key"`
+	Pressed  json.RawMessage `json:"pressed"`
+	Released json.RawMessage `json:"released"`
+}
+
+type Mapping struct {
+	Axes    []AxisMapping   `json:"axes"`
+	Buttons []ButtonMapping `json:"buttons"`
+}
+
+type inputEvent struct {
+	Time  syscall.Timeval
+	Type  uint16
+	Code  uint16
+	Value int32
+}
+
+type axis struct {
+	AxisMapping
+	code     uint16
+	min, max int32
+}
+
+type button struct {
+	ButtonMapping
+	code uint16
+}
+
+type AJoystick struct {
+	mu           sync.Mutex
+	address      int
+	priority     string
+	isActive     bool
+	lastActivity time.Time
+}
+
+type RunParams struct {
+	Device                string
+	MappingPath           string
+	SendIntervalMs        int
+	IdleTimeoutMs         int
+	ReconnectTimeoutSec   int
+	SendChan              chan string
+	IsRemoteControlActive func(int) bool
+	// OnTakeOver is called with the address when the joystick takes over the controls, could be nil
+	OnTakeOver func(int)
+}
+
+func Factory(address int, priority string) *AJoystick {
+	if priority != Override && priority != Fallback {
+		panic("joystick_priority param has wrong value")
+	}
+
+	return &AJoystick{
+		address:  address,
+		priority: priority,
+	}
+}
+
+// IsOverriding reports whether remote controls for the address should be held back
+func (j *AJoystick) IsOverriding(address int) bool {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	return j.priority == Override && j.isActive && j.address == address
+}
+
+func (j *AJoystick) setActive(state bool) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.isActive = state
+}
+
+func LoadMapping(path string) (Mapping, error) {
+	var m Mapping
+
+	data, err := ioutil.ReadFile(path)
+
+	if err != nil {
+		return m, err
+	}
+
+	err = json.Unmarshal(data, &m)
+
+	return m, err
+}
+
+func (j *AJoystick) Run(p RunParams) {
+	mapping, err := LoadMapping(p.MappingPath)
+
+	if err != nil {
+		log.Println("Joystick: load mapping error", err)
+		panic(err)
+	}
+
+	axes := make([]*axis, 0, len(mapping.Axes))
+
+	for _, a := range mapping.Axes {
+		code, err := parseCode(a.Code)
+
+		if err != nil {
+			panic(err)
+		}
+
+		if a.Scale == 0 {
+			a.Scale = 100
+		}
+
+		axes = append(axes, &axis{AxisMapping: a, code: code, min: -32768, max: 32767})
+	}
+
+	buttons := make([]*button, 0, len(mapping.Buttons))
+
+	for _, b := range mapping.Buttons {
+		code, err := parseCode(b.Code)
+
+		if err != nil {
+			panic(err)
+		}
+
+		if len(b.Pressed) == 0 {
+			b.Pressed = json.RawMessage("1")
+		}
+
+		if len(b.Released) == 0 {
+			b.Released = json.RawMessage("0")
+		}
+
+		buttons = append(buttons, &button{ButtonMapping: b, code: code})
+	}
+
+	neutral := make(map[string]interface{})
+
+	for _, a := range axes {
+		neutral[a.Key] = 0
+	}
+
+	for _, b := range buttons {
+		neutral[b.Key] = b.Released
+	}
+
+	events := make(chan inputEvent, 100)
+
+	go j.read(p, axes, events)
+
+	state := copyState(neutral)
+	isDirty := false
+
+	ticker := time.NewTicker(time.Duration(p.SendIntervalMs) * time.Millisecond)
+	defer ticker.Stop()
+
+	idleTimeout := time.Duration(p.IdleTimeoutMs) * time.Millisecond
+
+	for {
+		select {
+		case ev := <-events:
+			switch ev.Type {
+			case evAbs:
+				j.mu.Lock()
+				for _, a := range axes {
+					if a.code == ev.Code {
+						applyAxis(state, a, ev.Value)
+					}
+				}
+				j.mu.Unlock()
+
+			case evKey:
+				for _, b := range buttons {
+					if b.code == ev.Code {
+						if ev.Value != 0 {
+							state[b.Key] = b.Pressed
+						} else {
+							state[b.Key] = b.Released
+						}
+					}
+				}
+
+			case evSyn:
+				if ev.Code == synReport {
+					isDirty = true
+					j.mu.Lock()
+					j.lastActivity = time.Now()
+					j.mu.Unlock()
+				}
+			}
+
+		case <-ticker.C:
+			j.mu.Lock()
+			isActive := j.isActive
+			isInUse := time.Since(j.lastActivity) < idleTimeout || !isSameState(state, neutral)
+			j.mu.Unlock()
+
+			if j.priority == Fallback && p.IsRemoteControlActive(j.address) {
+				if isActive {
+					log.Println("Joystick: remote operator connected, releasing controls")
+					j.send(p.SendChan, neutral)
+					j.setActive(false)
+					isDirty = false
+				}
+
+				continue
+			}
+
+			if isInUse && !isActive {
+				log.Println("Joystick: taking over controls for address", j.address)
+				j.setActive(true)
+
+				if p.OnTakeOver != nil {
+					p.OnTakeOver(j.address)
+				}
+
+				p.SendChan <- fmt.Sprintf("{\"address\":%d,\"controls\":{\"start\":true}}", j.address)
+				isDirty = true
+			}
+
+			if !isInUse && isActive {
+				log.Println("Joystick: idle, releasing controls for address", j.address)
+				j.send(p.SendChan, neutral)
+				j.setActive(false)
+				isDirty = false
+			}
+
+			if isDirty && isInUse {
+				j.send(p.SendChan, state)
+				isDirty = false
+			}
+		}
+	}
+}
+
+func (j *AJoystick) send(sendChan chan string, state map[string]interface{}) {
+	controls, err := json.Marshal(state)
+
+	if err != nil {
+		log.Println("Joystick: serialize controls error", err)
+		return
+	}
+
+	sendChan <- fmt.Sprintf("{\"address\":%d,\"controls\":%s}", j.address, controls)
+}
+
+// read opens the device and forwards its events, reopening it after unplug.
+// Regular files are treated as recorded event streams and replayed with the original timing.
+func (j *AJoystick) read(p RunParams, axes []*axis, events chan inputEvent) {
+	for {
+		f, err := os.Open(p.Device)
+
+		if err != nil {
+			log.Println("Joystick: open device error", err)
+			time.Sleep(time.Duration(p.ReconnectTimeoutSec) * time.Second)
+			continue
+		}
+
+		log.Println("Joystick: reading events from", p.Device)
+
+		j.mu.Lock()
+		for _, a := range axes {
+			if a.Min != nil && a.Max != nil {
+				a.min, a.max = *a.Min, *a.Max
+				continue
+			}
+
+			if min, max, ok := queryAxisRange(f, a.code); ok {
+				a.min, a.max = min, max
+			}
+		}
+		j.mu.Unlock()
+
+		stat, err := f.Stat()
+		isRecording := err == nil && stat.Mode().IsRegular()
+
+		reader := bufio.NewReader(f)
+		var previous *inputEvent
+
+		for {
+			var ev inputEvent
+
+			err = binary.Read(reader, binary.LittleEndian, &ev)
+
+			if err != nil {
+				break
+			}
+
+			if isRecording && previous != nil {
+				delay := time.Duration(syscall.TimevalToNsec(ev.Time) - syscall.TimevalToNsec(previous.Time))
+
+				if delay > 0 {
+					time.Sleep(delay)
+				}
+			}
+
+			previous = &ev
+
+			events <- ev
+		}
+
+		f.Close()
+
+		if isRecording && err == io.EOF {
+			log.Println("Joystick: recorded event stream finished")
+			return
+		}
+
+		log.Println("Joystick: read device error", err)
+		time.Sleep(time.Duration(p.ReconnectTimeoutSec) * time.Second)
+	}
+}
+
+func applyAxis(state map[string]interface{}, a *axis, raw int32) {
+	center := (float64(a.min) + float64(a.max)) / 2
+	halfRange := (float64(a.max) - float64(a.min)) / 2
+
+	if halfRange == 0 {
+		return
+	}
+
+	value := (float64(raw) - center) / halfRange
+
+	if a.Invert {
+		value = -value
+	}
+
+	if math.Abs(value) < a.Deadzone {
+		value = 0
+	}
+
+	switch a.Direction {
+	case "positive":
+		value = math.Max(value, 0)
+	case "negative":
+		value = math.Max(-value, 0)
+	}
+
+	value = math.Max(math.Min(value, 1), -1)
+
+	state[a.Key] = int(math.Round(value * a.Scale))
+}
+
+func copyState(state map[string]interface{}) map[string]interface{} {
+	c := make(map[string]interface{}, len(state))
+
+	for k, v := range state {
+		c[k] = v
+	}
+
+	return c
+}
+
+func isSameState(a map[string]interface{}, b map[string]interface{}) bool {
+	ja, _ := json.Marshal(a)
+	jb, _ := json.Marshal(b)
+
+	return string(ja) == string(jb)
+}
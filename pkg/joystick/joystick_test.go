@@ -0,0 +1,121 @@
+package joystick
+
+import (
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+)
+
+const testMapping = `{
+	"axes": [{"code": "ABS_X", "key": "x", "min": -100, "max": 100}],
+	"buttons": [{"code": "BTN_A", "key": "fire"}]
+}`
+
+// writeRecording stores the events as the recorded event stream, the way 'evemu-record' or 'cat /dev/input/eventN' does
+func writeRecording(t *testing.T, dir string, events []inputEvent) string {
+	path := filepath.Join(dir, "events.bin")
+
+	f, err := os.Create(path)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer f.Close()
+
+	for i, ev := range events {
+		ev.Time = syscall.NsecToTimeval(int64(i) * int64(time.Millisecond))
+
+		err := binary.Write(f, binary.LittleEndian, ev)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return path
+}
+
+func startReplay(t *testing.T, priority string, isRemoteActive *int32) chan string {
+	dir, err := ioutil.TempDir("", "joystick")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	mappingPath := filepath.Join(dir, "mapping.json")
+
+	err = ioutil.WriteFile(mappingPath, []byte(testMapping), 0644)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	device := writeRecording(t, dir, []inputEvent{
+		{Type: evAbs, Code: codeNames["ABS_X"], Value: 100},
+		{Type: evKey, Code: codeNames["BTN_A"], Value: 1},
+		{Type: evSyn, Code: synReport},
+	})
+
+	sendChan := make(chan string, 100)
+
+	j := Factory(7, priority)
+
+	go j.Run(RunParams{
+		Device:              device,
+		MappingPath:         mappingPath,
+		SendIntervalMs:      10,
+		IdleTimeoutMs:       5000,
+		ReconnectTimeoutSec: 1,
+		SendChan:            sendChan,
+		IsRemoteControlActive: func(int) bool {
+			return atomic.LoadInt32(isRemoteActive) == 1
+		},
+	})
+
+	return sendChan
+}
+
+func expectMessage(t *testing.T, sendChan chan string, expected string) {
+	timeout := time.After(2 * time.Second)
+
+	for {
+		select {
+		case message := <-sendChan:
+			if message == expected {
+				return
+			}
+
+		case <-timeout:
+			t.Fatalf("message %s is not sent", expected)
+		}
+	}
+}
+
+func TestReplayMapsAxesAndButtons(t *testing.T) {
+	var isRemoteActive int32
+
+	sendChan := startReplay(t, Override, &isRemoteActive)
+
+	expectMessage(t, sendChan, `{"address":7,"controls":{"start":true}}`)
+	expectMessage(t, sendChan, `{"address":7,"controls":{"fire":1,"x":100}}`)
+}
+
+func TestFallbackReleasesWithNeutralState(t *testing.T) {
+	var isRemoteActive int32
+
+	sendChan := startReplay(t, Fallback, &isRemoteActive)
+
+	expectMessage(t, sendChan, `{"address":7,"controls":{"fire":1,"x":100}}`)
+
+	atomic.StoreInt32(&isRemoteActive, 1)
+
+	expectMessage(t, sendChan, `{"address":7,"controls":{"fire":0,"x":0}}`)
+}
@@ -0,0 +1,175 @@
+package macro
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"time"
+)
+
+const (
+	Running   = "running"
+	Done      = "done"
+	Cancelled = "cancelled"
+	Aborted   = "aborted"
+	Declined  = "declined"
+	NotFound  = "not_found"
+)
+
+type Step struct {
+	// Controls payload sent to the robot, could be omitted for a pure delay
+	Controls json.RawMessage `json:"controls"`
+	// DurationMs is a delay before the next step
+	DurationMs int `json:"durationMs"`
+	// RepeatMs resends controls during the step for robots with command watchdog
+	RepeatMs int `json:"repeatMs"`
+}
+
+type Macro struct {
+	Steps     []Step          `json:"steps"`
+	SafeState json.RawMessage `json:"safeState"`
+}
+
+type Config struct {
+	SafeState json.RawMessage  `json:"safeState"`
+	Macros    map[string]Macro `json:"macros"`
+}
+
+type Progress struct {
+	Name   string `json:"name"`
+	Step   int    `json:"step"`
+	Total  int    `json:"total"`
+	Status string `json:"status"`
+}
+
+type RunParams struct {
+	Address    int
+	SendChan   chan string
+	CancelChan chan string
+	OnProgress func(Progress)
+	// FilterControls applies the operator permissions to the step controls, could be nil
+	FilterControls func(string) (string, error)
+}
+
+func Load(path string) (Config, error) {
+	var c Config
+
+	data, err := ioutil.ReadFile(path)
+
+	if err != nil {
+		return c, err
+	}
+
+	err = json.Unmarshal(data, &c)
+
+	return c, err
+}
+
+func (c Config) Has(name string) bool {
+	_, ok := c.Macros[name]
+	return ok
+}
+
+func (c Config) send(p RunParams, controls json.RawMessage) {
+	p.SendChan <- fmt.Sprintf("{\"address\":%d,\"controls\":%s}", p.Address, controls)
+}
+
+// sendStep sends the step controls unless they are declined by the operator permissions,
+// the safe state is not filtered
+func (c Config) sendStep(p RunParams, controls json.RawMessage) {
+	if p.FilterControls != nil {
+		filtered, err := p.FilterControls(string(controls))
+
+		if err != nil {
+			log.Println("Macro step declined by operator permissions:", p.Address, err)
+			return
+		}
+
+		controls = json.RawMessage(filtered)
+	}
+
+	c.send(p, controls)
+}
+
+func (c Config) sendSafeState(p RunParams, m Macro) {
+	safeState := m.SafeState
+
+	if len(safeState) == 0 {
+		safeState = c.SafeState
+	}
+
+	if len(safeState) == 0 {
+		c.send(p, json.RawMessage("{\"stop\":true}"))
+		c.send(p, json.RawMessage("{\"start\":true}"))
+		return
+	}
+
+	c.send(p, safeState)
+}
+
+// Run emits the timed command sequence and always finishes with the safe state.
+// Writing Cancelled or Aborted reason to CancelChan interrupts the sequence.
+func (c Config) Run(name string, p RunParams) {
+	m, ok := c.Macros[name]
+
+	if !ok {
+		log.Println("Macro not found:", name)
+		return
+	}
+
+	total := len(m.Steps)
+	current := total
+	status := Done
+
+	log.Println("Running macro:", name, p.Address)
+
+	for i, step := range m.Steps {
+		p.OnProgress(Progress{Name: name, Step: i + 1, Total: total, Status: Running})
+
+		if len(step.Controls) > 0 {
+			c.sendStep(p, step.Controls)
+		}
+
+		reason := c.wait(p, step)
+
+		if reason != "" {
+			current = i + 1
+			status = reason
+			break
+		}
+	}
+
+	c.sendSafeState(p, m)
+
+	log.Println("Macro finished:", name, p.Address, status)
+
+	p.OnProgress(Progress{Name: name, Step: current, Total: total, Status: status})
+}
+
+// wait holds the step for its duration, returns the cancellation reason if interrupted
+func (c Config) wait(p RunParams, step Step) string {
+	timer := time.NewTimer(time.Duration(step.DurationMs) * time.Millisecond)
+	defer timer.Stop()
+
+	var repeat <-chan time.Time
+
+	if step.RepeatMs > 0 && len(step.Controls) > 0 {
+		ticker := time.NewTicker(time.Duration(step.RepeatMs) * time.Millisecond)
+		defer ticker.Stop()
+		repeat = ticker.C
+	}
+
+	for {
+		select {
+		case <-timer.C:
+			return ""
+
+		case <-repeat:
+			c.sendStep(p, step.Controls)
+
+		case reason := <-p.CancelChan:
+			return reason
+		}
+	}
+}
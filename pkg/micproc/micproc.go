@@ -0,0 +1,261 @@
+// Package micproc cleans up the microphone audio before encoding: high-pass filter against the motor whine
+// and the rumble, noise gate and automatic gain control
+package micproc
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"sync"
+
+	"github.com/pion/mediadevices/pkg/io/audio"
+	"github.com/pion/mediadevices/pkg/wave"
+)
+
+const (
+	StageHighPass  = "highPass"
+	StageNoiseGate = "noiseGate"
+	StageAGC       = "agc"
+)
+
+type Config struct {
+	IsHighPassEnabled bool
+	// HighPassCutoff in Hz
+	HighPassCutoff float64
+
+	IsNoiseGateEnabled bool
+	// NoiseGateThreshold in dBFS, the audio is muted while its level stays below
+	NoiseGateThreshold float64
+
+	IsAGCEnabled bool
+	// AGCTarget level in dBFS
+	AGCTarget float64
+	// AGCMaxGain in dB, limits the amplification of the quiet speech
+	AGCMaxGain float64
+}
+
+func (c Config) Validate() error {
+	if c.HighPassCutoff < 20 || c.HighPassCutoff > 2000 {
+		return fmt.Errorf("high-pass cutoff should be in 20-2000 Hz range: %v", c.HighPassCutoff)
+	}
+
+	if c.NoiseGateThreshold < -90 || c.NoiseGateThreshold > 0 {
+		return fmt.Errorf("noise gate threshold should be in -90-0 dBFS range: %v", c.NoiseGateThreshold)
+	}
+
+	if c.AGCTarget < -40 || c.AGCTarget > 0 {
+		return fmt.Errorf("AGC target should be in -40-0 dBFS range: %v", c.AGCTarget)
+	}
+
+	if c.AGCMaxGain < 0 || c.AGCMaxGain > 40 {
+		return fmt.Errorf("AGC max gain should be in 0-40 dB range: %v", c.AGCMaxGain)
+	}
+
+	return nil
+}
+
+// AProcessor is shared by all the sessions, the stages are toggled at runtime
+type AProcessor struct {
+	mu        sync.Mutex
+	config    Config
+	highPass  []biquad
+	gate      noiseGate
+	agc       gainControl
+	rate      int
+	samples   []float64
+	isChanged bool
+}
+
+func Factory(c Config) *AProcessor {
+	return &AProcessor{config: c, agc: gainControl{gain: 1}}
+}
+
+// SetEnabled toggles the stage of the chain
+func (p *AProcessor) SetEnabled(stage string, state bool) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	switch stage {
+	case StageHighPass:
+		p.config.IsHighPassEnabled = state
+	case StageNoiseGate:
+		p.config.IsNoiseGateEnabled = state
+	case StageAGC:
+		p.config.IsAGCEnabled = state
+	default:
+		return fmt.Errorf("unknown audio processing stage: %s", stage)
+	}
+
+	log.Println("Audio processing stage enabled:", stage, state)
+
+	// the stages start from the clean state, e.g. without the gain of the last time
+	p.isChanged = true
+
+	return nil
+}
+
+func (p *AProcessor) BuildStateMessage() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	type aPayload struct {
+		HighPass  bool `json:"highPass"`
+		NoiseGate bool `json:"noiseGate"`
+		AGC       bool `json:"agc"`
+	}
+
+	type aMessage struct {
+		Type    string   `json:"type"`
+		Payload aPayload `json:"payload"`
+	}
+
+	message, _ := json.Marshal(aMessage{
+		Type: "AUDIO_PROCESSING",
+		Payload: aPayload{
+			HighPass:  p.config.IsHighPassEnabled,
+			NoiseGate: p.config.IsNoiseGateEnabled,
+			AGC:       p.config.IsAGCEnabled,
+		},
+	})
+
+	return string(message)
+}
+
+// reset prepares the state of the stages for the chunk format
+func (p *AProcessor) reset(info wave.ChunkInfo) {
+	p.rate = info.SamplingRate
+	p.highPass = make([]biquad, info.Channels)
+
+	for i := range p.highPass {
+		p.highPass[i] = newHighPass(p.config.HighPassCutoff, float64(info.SamplingRate))
+	}
+
+	p.gate = noiseGate{}
+	p.agc = gainControl{gain: 1}
+	p.isChanged = false
+}
+
+func (p *AProcessor) process(input wave.Audio) wave.Audio {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	c := p.config
+
+	if !c.IsHighPassEnabled && !c.IsNoiseGateEnabled && !c.IsAGCEnabled {
+		return input
+	}
+
+	switch input.(type) {
+	case *wave.Int16Interleaved, *wave.Float32Interleaved:
+	default:
+		return input
+	}
+
+	info := input.ChunkInfo()
+
+	if p.isChanged || p.rate != info.SamplingRate || len(p.highPass) != info.Channels {
+		p.reset(info)
+	}
+
+	size := info.Len * info.Channels
+
+	if cap(p.samples) < size {
+		p.samples = make([]float64, size)
+	}
+
+	samples := p.samples[:size]
+
+	readSamples(input, samples)
+
+	if c.IsHighPassEnabled {
+		for i, sample := range samples {
+			samples[i] = p.highPass[i%info.Channels].process(sample)
+		}
+	}
+
+	isOpen := true
+
+	if c.IsNoiseGateEnabled {
+		isOpen = p.gate.process(samples, info, c.NoiseGateThreshold)
+	}
+
+	if c.IsAGCEnabled {
+		p.agc.process(samples, info, isOpen, c.AGCTarget, c.AGCMaxGain)
+	}
+
+	return writeSamples(input, samples)
+}
+
+// readSamples converts the interleaved chunk to -1..1 range, the wave conversion of int16 samples is off by half
+func readSamples(input wave.Audio, samples []float64) {
+	switch chunk := input.(type) {
+	case *wave.Int16Interleaved:
+		for i := range samples {
+			samples[i] = float64(chunk.Data[i]) / 32768
+		}
+
+	case *wave.Float32Interleaved:
+		for i := range samples {
+			samples[i] = float64(chunk.Data[i])
+		}
+	}
+}
+
+// writeSamples returns the new chunk of the input format
+func writeSamples(input wave.Audio, samples []float64) wave.Audio {
+	if _, ok := input.(*wave.Int16Interleaved); ok {
+		output := wave.NewInt16Interleaved(input.ChunkInfo())
+
+		for i, sample := range samples {
+			output.Data[i] = int16(math.Max(-1, math.Min(1, sample)) * 32767)
+		}
+
+		return output
+	}
+
+	output := wave.NewFloat32Interleaved(input.ChunkInfo())
+
+	for i, sample := range samples {
+		output.Data[i] = float32(math.Max(-1, math.Min(1, sample)))
+	}
+
+	return output
+}
+
+// Transform processes the interleaved microphone chunks, the chunks pass as is while all the stages are disabled
+func (p *AProcessor) Transform() audio.TransformFunc {
+	return func(r audio.Reader) audio.Reader {
+		return audio.ReaderFunc(func() (wave.Audio, func(), error) {
+			chunk, release, err := r.Read()
+
+			if err != nil {
+				return chunk, release, err
+			}
+
+			processed := p.process(chunk)
+
+			if processed != chunk {
+				release()
+				release = func() {}
+			}
+
+			return processed, release, nil
+		})
+	}
+}
+
+// level returns RMS of the samples in dBFS
+func level(samples []float64) float64 {
+	if len(samples) == 0 {
+		return -math.MaxFloat64
+	}
+
+	sum := 0.0
+
+	for _, sample := range samples {
+		sum += sample * sample
+	}
+
+	return 10 * math.Log10(sum/float64(len(samples))+1e-12)
+}
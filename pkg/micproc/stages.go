@@ -0,0 +1,122 @@
+package micproc
+
+import (
+	"math"
+
+	"github.com/pion/mediadevices/pkg/wave"
+)
+
+const (
+	gateHold    = 0.2
+	gateAttack  = 0.002
+	gateRelease = 0.05
+
+	// agcSilence in dBFS, the gain is kept while the level is below, so the pauses are not amplified
+	agcSilence = -60.0
+	// agcMinGain in dB limits the attenuation of the loud input
+	agcMinGain = -20.0
+	// agcAttack and agcRelease are the portions of the gain change applied per chunk,
+	// the gain drops quickly on the loud input and recovers slowly
+	agcAttack  = 0.5
+	agcRelease = 0.05
+)
+
+// biquad is a second order section in direct form I
+type biquad struct {
+	b0, b1, b2, a1, a2 float64
+	x1, x2, y1, y2     float64
+}
+
+// newHighPass is Butterworth high-pass filter of Audio EQ Cookbook
+func newHighPass(cutoff float64, rate float64) biquad {
+	w0 := 2 * math.Pi * math.Min(cutoff, rate/2*0.9) / rate
+	// Q of 1/√2
+	alpha := math.Sin(w0) / math.Sqrt2
+	cos := math.Cos(w0)
+	a0 := 1 + alpha
+
+	return biquad{
+		b0: (1 + cos) / 2 / a0,
+		b1: -(1 + cos) / a0,
+		b2: (1 + cos) / 2 / a0,
+		a1: -2 * cos / a0,
+		a2: (1 - alpha) / a0,
+	}
+}
+
+func (f *biquad) process(x float64) float64 {
+	y := f.b0*x + f.b1*f.x1 + f.b2*f.x2 - f.a1*f.y1 - f.a2*f.y2
+
+	f.x2, f.x1 = f.x1, x
+	f.y2, f.y1 = f.y1, y
+
+	return y
+}
+
+// noiseGate mutes the chunks below the threshold, it is held open for a while after the speech
+// so the word endings are not cut
+type noiseGate struct {
+	gain float64
+	hold int
+}
+
+func smoothing(time float64, rate int) float64 {
+	return 1 - math.Exp(-1/(time*float64(rate)))
+}
+
+// process returns whether the gate is open
+func (g *noiseGate) process(samples []float64, info wave.ChunkInfo, threshold float64) bool {
+	if level(samples) >= threshold {
+		g.hold = int(gateHold * float64(info.SamplingRate))
+	} else if g.hold > 0 {
+		g.hold -= info.Len
+	}
+
+	isOpen := g.hold > 0
+	target, coefficient := 0.0, smoothing(gateRelease, info.SamplingRate)
+
+	if isOpen {
+		target, coefficient = 1, smoothing(gateAttack, info.SamplingRate)
+	}
+
+	for i := 0; i < info.Len; i++ {
+		g.gain += (target - g.gain) * coefficient
+
+		for ch := 0; ch < info.Channels; ch++ {
+			samples[i*info.Channels+ch] *= g.gain
+		}
+	}
+
+	return isOpen
+}
+
+// gainControl brings the speech to the target level
+type gainControl struct {
+	gain float64
+}
+
+func (g *gainControl) process(samples []float64, info wave.ChunkInfo, isActive bool, target float64, maxGain float64) {
+	start := g.gain
+	input := level(samples)
+
+	if isActive && input > agcSilence {
+		current := 20 * math.Log10(g.gain)
+		desired := math.Max(agcMinGain, math.Min(maxGain, target-input))
+		rate := agcRelease
+
+		if desired < current {
+			rate = agcAttack
+		}
+
+		g.gain = math.Pow(10, (current+(desired-current)*rate)/20)
+	}
+
+	// the gain is ramped over the chunk to avoid clicks
+	for i := 0; i < info.Len; i++ {
+		gain := start + (g.gain-start)*float64(i+1)/float64(info.Len)
+
+		for ch := 0; ch < info.Channels; ch++ {
+			samples[i*info.Channels+ch] *= gain
+		}
+	}
+}
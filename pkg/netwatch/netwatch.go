@@ -0,0 +1,106 @@
+// Package netwatch notifies about changes of the local network interfaces and their addresses
+package netwatch
+
+import (
+	"log"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// AWatcher polls the interfaces, so it works the same way for Wi-Fi, LTE modems and USB tethering
+type AWatcher struct {
+	mu          sync.Mutex
+	subscribers []chan struct{}
+	filter      func(string) bool
+	snapshot    string
+}
+
+// Factory starts watching the interfaces allowed by the filter, nil filter allows all
+func Factory(interval time.Duration, filter func(string) bool) *AWatcher {
+	w := &AWatcher{
+		subscribers: make([]chan struct{}, 0),
+		filter:      filter,
+	}
+
+	w.snapshot = w.takeSnapshot()
+
+	go w.run(interval)
+
+	return w
+}
+
+// Subscribe returns a channel receiving a notification after every change, the notifications are coalesced
+func (w *AWatcher) Subscribe() chan struct{} {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	c := make(chan struct{}, 1)
+	w.subscribers = append(w.subscribers, c)
+
+	return c
+}
+
+// takeSnapshot lists the addresses of the interfaces which are up, loopback is skipped
+func (w *AWatcher) takeSnapshot() string {
+	interfaces, err := net.Interfaces()
+
+	if err != nil {
+		log.Println("List network interfaces error", err)
+		return w.snapshot
+	}
+
+	entries := make([]string, 0)
+
+	for _, i := range interfaces {
+		if i.Flags&net.FlagUp == 0 || i.Flags&net.FlagLoopback != 0 {
+			continue
+		}
+
+		if w.filter != nil && !w.filter(i.Name) {
+			continue
+		}
+
+		addresses, err := i.Addrs()
+
+		if err != nil {
+			continue
+		}
+
+		for _, address := range addresses {
+			entries = append(entries, i.Name+"="+address.String())
+		}
+	}
+
+	sort.Strings(entries)
+
+	return strings.Join(entries, ",")
+}
+
+func (w *AWatcher) run(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		snapshot := w.takeSnapshot()
+
+		if snapshot == w.snapshot {
+			continue
+		}
+
+		log.Println("Network changed:", w.snapshot, "->", snapshot)
+
+		w.snapshot = snapshot
+
+		w.mu.Lock()
+		for _, c := range w.subscribers {
+			select {
+			case c <- struct{}{}:
+			default:
+			}
+		}
+		w.mu.Unlock()
+	}
+}
@@ -0,0 +1,234 @@
+// Package osd burns telemetry values into the video frames before encoding
+package osd
+
+import (
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"io/ioutil"
+	"sync"
+	"time"
+
+	"github.com/pion/mediadevices/pkg/io/video"
+)
+
+const (
+	// FieldTimestamp - current time
+	FieldTimestamp = "timestamp"
+	// FieldRTT - round trip time of the operator connection
+	FieldRTT = "rtt"
+
+	missingValue = "--"
+)
+
+type Item struct {
+	// Field is a dot separated path in the robot telemetry, e.g. 'battery.value' or 'genericData.speed',
+	// or one of 'timestamp', 'rtt'
+	Field string `json:"field"`
+	// ID of the bot the telemetry belongs to
+	ID    int    `json:"id"`
+	Label string `json:"label"`
+	// Format is fmt verb for the value, '%v' by default
+	Format string `json:"format"`
+	// X and Y are text positions in characters and lines, negative values are counted from the right and the bottom
+	X int `json:"x"`
+	Y int `json:"y"`
+}
+
+type Layout struct {
+	// Scale of the 7x13 font, picked by the frame width when not set
+	Scale int    `json:"scale"`
+	Items []Item `json:"items"`
+}
+
+// AnOverlay keeps the latest values to be drawn on every frame
+type AnOverlay struct {
+	mu     sync.Mutex
+	layout Layout
+	values map[string]interface{}
+}
+
+func Load(path string) (Layout, error) {
+	var l Layout
+
+	data, err := ioutil.ReadFile(path)
+
+	if err != nil {
+		return l, err
+	}
+
+	err = json.Unmarshal(data, &l)
+
+	return l, err
+}
+
+func Factory(layout Layout) *AnOverlay {
+	return &AnOverlay{
+		layout: layout,
+		values: make(map[string]interface{}),
+	}
+}
+
+func valueKey(id int, field string) string {
+	return fmt.Sprintf("%d/%s", id, field)
+}
+
+func (o *AnOverlay) flatten(id int, prefix string, data map[string]interface{}) {
+	for key, value := range data {
+		field := key
+
+		if prefix != "" {
+			field = prefix + "." + key
+		}
+
+		if nested, ok := value.(map[string]interface{}); ok {
+			o.flatten(id, field, nested)
+			continue
+		}
+
+		o.values[valueKey(id, field)] = value
+	}
+}
+
+// SetTelemetry stores the fields of the robot telemetry message
+func (o *AnOverlay) SetTelemetry(id int, data map[string]interface{}) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	o.flatten(id, "", data)
+}
+
+func (o *AnOverlay) SetRTT(id int, rtt time.Duration) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	o.values[valueKey(id, FieldRTT)] = fmt.Sprintf("%dms", rtt.Milliseconds())
+}
+
+func (o *AnOverlay) format(item Item, now time.Time) string {
+	var text string
+
+	switch item.Field {
+	case FieldTimestamp:
+		text = now.Format("2006-01-02 15:04:05")
+
+	default:
+		value, ok := o.values[valueKey(item.ID, item.Field)]
+
+		if !ok {
+			text = missingValue
+		} else if item.Format != "" {
+			text = fmt.Sprintf(item.Format, value)
+		} else {
+			text = fmt.Sprint(value)
+		}
+	}
+
+	if item.Label != "" {
+		text = item.Label + " " + text
+	}
+
+	return text
+}
+
+func (o *AnOverlay) draw(img draw.Image) {
+	bounds := img.Bounds()
+	scale := o.layout.Scale
+
+	if scale <= 0 {
+		scale = bounds.Dx() / 320
+
+		if scale < 1 {
+			scale = 1
+		}
+	}
+
+	lineHeight := LineHeight(scale)
+	charWidth := TextWidth(" ", scale)
+	now := time.Now()
+
+	o.mu.Lock()
+	lines := make([]string, len(o.layout.Items))
+
+	for i, item := range o.layout.Items {
+		lines[i] = o.format(item, now)
+	}
+	o.mu.Unlock()
+
+	for i, item := range o.layout.Items {
+		text := lines[i]
+
+		x := bounds.Min.X + item.X*charWidth
+		y := bounds.Min.Y + item.Y*lineHeight
+
+		if item.X < 0 {
+			x = bounds.Max.X + item.X*charWidth - TextWidth(text, scale)
+		}
+
+		if item.Y < 0 {
+			y = bounds.Max.Y + item.Y*lineHeight
+		}
+
+		DrawText(img, text, image.Pt(x, y), scale)
+	}
+}
+
+// Transform draws the overlay on the frames in place, the camera frames are drawn into the Y plane,
+// the frames of the other formats are converted to RGBA
+func (o *AnOverlay) Transform() video.TransformFunc {
+	return func(r video.Reader) video.Reader {
+		return video.ReaderFunc(func() (image.Image, func(), error) {
+			img, release, err := r.Read()
+
+			if err != nil {
+				return img, release, err
+			}
+
+			switch frame := img.(type) {
+			case *image.RGBA:
+				o.draw(frame)
+				return frame, release, nil
+
+			case *image.YCbCr:
+				o.draw(aLumaCanvas{frame})
+				return frame, release, nil
+			}
+
+			canvas := image.NewRGBA(img.Bounds())
+			draw.Draw(canvas, canvas.Bounds(), img, img.Bounds().Min, draw.Src)
+			release()
+
+			o.draw(canvas)
+
+			return canvas, func() {}, nil
+		})
+	}
+}
+
+// aLumaCanvas draws into the Y plane of YUV frame, the chroma is kept, so the text is white and its background
+// is darkened. Only the pixels of the text are touched instead of converting the whole frame to RGBA and back
+type aLumaCanvas struct {
+	*image.YCbCr
+}
+
+func (c aLumaCanvas) ColorModel() color.Model {
+	return color.GrayModel
+}
+
+func (c aLumaCanvas) At(x, y int) color.Color {
+	if !(image.Point{x, y}.In(c.Rect)) {
+		return color.Gray{}
+	}
+
+	return color.Gray{Y: c.Y[c.YOffset(x, y)]}
+}
+
+func (c aLumaCanvas) Set(x, y int, value color.Color) {
+	if !(image.Point{x, y}.In(c.Rect)) {
+		return
+	}
+
+	c.Y[c.YOffset(x, y)] = color.GrayModel.Convert(value).(color.Gray).Y
+}
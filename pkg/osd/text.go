@@ -0,0 +1,46 @@
+package osd
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+
+	xdraw "golang.org/x/image/draw"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/math/fixed"
+)
+
+var textBackground = &image.Uniform{color.RGBA{0, 0, 0, 160}}
+
+// LineHeight of the text drawn with the scale
+func LineHeight(scale int) int {
+	return basicfont.Face7x13.Height * scale
+}
+
+// TextWidth of the text drawn with the scale
+func TextWidth(text string, scale int) int {
+	return font.MeasureString(basicfont.Face7x13, text).Ceil() * scale
+}
+
+// DrawText renders the line with the basic font scaled up to stay readable after encoding
+func DrawText(img draw.Image, text string, at image.Point, scale int) {
+	face := basicfont.Face7x13
+	width := font.MeasureString(face, text).Ceil()
+	height := face.Height
+
+	line := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(line, line.Bounds(), textBackground, image.Point{}, draw.Src)
+
+	drawer := font.Drawer{
+		Dst:  line,
+		Src:  image.White,
+		Face: face,
+		Dot:  fixed.P(0, face.Ascent),
+	}
+
+	drawer.DrawString(text)
+
+	target := image.Rect(at.X, at.Y, at.X+width*scale, at.Y+height*scale)
+	xdraw.NearestNeighbor.Scale(img, target, line, line.Bounds(), xdraw.Over, nil)
+}
@@ -0,0 +1,534 @@
+package peertrack
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pion/interceptor"
+	"github.com/pion/interceptor/pkg/cc"
+	"github.com/pion/mediadevices"
+	"github.com/pion/mediadevices/pkg/codec"
+	"github.com/pion/mediadevices/pkg/io/video"
+	"github.com/pion/mediadevices/pkg/prop"
+	"github.com/pion/rtcp"
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v3"
+)
+
+const (
+	rtpOutboundMTU = 1200
+	rtcpInboundMTU = 1500
+
+	// bitrate changes smaller than this ratio are ignored to avoid encoder churn
+	bitRateHysteresis = 0.1
+	// encoders without runtime bitrate control are rebuilt not more often than this
+	rebuildInterval = 5 * time.Second
+	controlInterval = time.Second
+)
+
+const (
+	// QualityAuto - resolution and bitrate follow the estimated bandwidth
+	QualityAuto = "auto"
+	// QualityFull, QualityHalf and QualityQuarter cap the resolution and the bitrate of the session
+	QualityFull    = "full"
+	QualityHalf    = "half"
+	QualityQuarter = "quarter"
+)
+
+var qualityScales = map[string]int{
+	QualityAuto:    1,
+	QualityFull:    1,
+	QualityHalf:    2,
+	QualityQuarter: 4,
+}
+
+func IsValidQuality(quality string) bool {
+	_, ok := qualityScales[quality]
+	return ok
+}
+
+// EncoderFactory builds encoder params for the negotiated mime type and the target bitrate
+type EncoderFactory func(mimeType string, bitRate int) (codec.VideoEncoderBuilder, error)
+
+// Source is a video track which allows multiple readers, e.g. *mediadevices.VideoTrack
+type Source interface {
+	mediadevices.Track
+	NewReader(copyFrame bool) video.Reader
+}
+
+type Config struct {
+	NewEncoder           EncoderFactory
+	InitialBitRate       int
+	MinBitRate           int
+	MaxBitRate           int
+	IsAdaptiveResolution bool
+	IsAdaptiveFrameRate  bool
+}
+
+// Stats is reported to the Client App on every encoder reconfiguration
+type Stats struct {
+	Quality          string  `json:"quality"`
+	BitRate          int     `json:"bitRate"`
+	EstimatedBitRate int     `json:"estimatedBitRate"`
+	Scale            int     `json:"scale"`
+	FrameRate        float64 `json:"frameRate"`
+}
+
+type encoderSettings struct {
+	bitRate   int
+	scale     int
+	frameRate float64
+}
+
+// ATrack is a video track with the encoder dedicated to a single peer connection,
+// so its bitrate follows the congestion feedback of that peer only
+type ATrack struct {
+	mu        sync.Mutex
+	id        string
+	source    Source
+	config    Config
+	estimator cc.BandwidthEstimator
+	onStats   func(Stats)
+
+	encoder       codec.ReadCloser
+	current       encoderSettings
+	pending       *encoderSettings
+	remb          int
+	inputProp     prop.Media
+	quality       string
+	lastRebuild   time.Time
+	stopChan      chan struct{}
+	stoppedChan   chan struct{}
+	isKeyFrameReq bool
+}
+
+// New creates a per-peer track published under the id, estimator could be nil when TWCC is not available
+func New(id string, source Source, config Config, estimator cc.BandwidthEstimator, onStats func(Stats)) *ATrack {
+	bitRate := config.InitialBitRate
+
+	if bitRate > config.MaxBitRate {
+		bitRate = config.MaxBitRate
+	}
+
+	if bitRate < config.MinBitRate {
+		bitRate = config.MinBitRate
+	}
+
+	return &ATrack{
+		id:        id,
+		source:    source,
+		config:    config,
+		estimator: estimator,
+		onStats:   onStats,
+		current:   encoderSettings{bitRate: bitRate, scale: 1},
+		quality:   QualityAuto,
+	}
+}
+
+// SetQuality switches the session to a fixed quality, the change is applied without waiting for the rebuild interval
+func (t *ATrack) SetQuality(quality string) error {
+	if !IsValidQuality(quality) {
+		return fmt.Errorf("unknown video quality: %s", quality)
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.quality == quality {
+		return nil
+	}
+
+	log.Println("Per-peer video quality:", t.id, t.quality, "->", quality)
+
+	t.quality = quality
+	t.lastRebuild = time.Time{}
+
+	return nil
+}
+
+func (t *ATrack) ID() string {
+	return t.id
+}
+
+func (t *ATrack) RID() string {
+	return ""
+}
+
+func (t *ATrack) StreamID() string {
+	return t.source.StreamID()
+}
+
+func (t *ATrack) Kind() webrtc.RTPCodecType {
+	return webrtc.RTPCodecTypeVideo
+}
+
+// detectInputProp reads a frame to find out the source video properties
+func (t *ATrack) detectInputProp() (prop.Media, error) {
+	var inputProp prop.Media
+
+	reader := video.DetectChanges(0, 0, func(p prop.Media) { inputProp = p })(t.source.NewReader(false))
+	_, _, err := reader.Read()
+
+	return inputProp, err
+}
+
+func (t *ATrack) buildEncoder(builder codec.VideoEncoderBuilder, s encoderSettings) (codec.ReadCloser, error) {
+	reader := t.source.NewReader(false)
+	inputProp := t.inputProp
+	transforms := make([]video.TransformFunc, 0)
+
+	if s.scale > 1 && inputProp.Width > 0 && inputProp.Height > 0 {
+		// keep dimensions even for chroma subsampling
+		inputProp.Width = inputProp.Width / s.scale &^ 1
+		inputProp.Height = inputProp.Height / s.scale &^ 1
+		transforms = append(transforms, video.Scale(inputProp.Width, inputProp.Height, nil))
+	}
+
+	if s.frameRate > 0 {
+		inputProp.FrameRate = float32(s.frameRate)
+		transforms = append(transforms, video.Throttle(float32(s.frameRate)))
+	}
+
+	if len(transforms) > 0 {
+		reader = video.Merge(transforms...)(reader)
+	}
+
+	return builder.BuildVideoEncoder(reader, inputProp)
+}
+
+func (t *ATrack) Bind(ctx webrtc.TrackLocalContext) (webrtc.RTPCodecParameters, error) {
+	inputProp, err := t.detectInputProp()
+
+	if err != nil {
+		return webrtc.RTPCodecParameters{}, err
+	}
+
+	t.mu.Lock()
+	t.inputProp = inputProp
+	settings := t.current
+	t.mu.Unlock()
+
+	var errReasons []string
+
+	for _, wantedCodec := range ctx.CodecParameters() {
+		builder, err := t.config.NewEncoder(wantedCodec.MimeType, settings.bitRate)
+
+		if err != nil {
+			errReasons = append(errReasons, fmt.Sprintf("%s: %s", wantedCodec.MimeType, err))
+			continue
+		}
+
+		encoder, err := t.buildEncoder(builder, settings)
+
+		if err != nil {
+			errReasons = append(errReasons, fmt.Sprintf("%s: %s", wantedCodec.MimeType, err))
+			continue
+		}
+
+		rtpCodec := builder.RTPCodec()
+
+		packetizer := rtp.NewPacketizer(
+			rtpOutboundMTU,
+			uint8(wantedCodec.PayloadType),
+			uint32(ctx.SSRC()),
+			rtpCodec.Payloader,
+			rtp.NewRandomSequencer(),
+			rtpCodec.ClockRate,
+		)
+
+		stopChan := make(chan struct{})
+		stoppedChan := make(chan struct{})
+
+		t.mu.Lock()
+		t.encoder = encoder
+		t.lastRebuild = time.Now()
+		t.stopChan = stopChan
+		t.stoppedChan = stoppedChan
+		t.mu.Unlock()
+
+		log.Println("Per-peer video encoder started:", t.id, wantedCodec.MimeType, settings.bitRate)
+
+		go t.writeLoop(ctx, wantedCodec.MimeType, packetizer, rtpCodec.ClockRate, stopChan, stoppedChan)
+		go t.rtcpLoop(ctx.RTCPReader())
+		go t.controlLoop(stopChan)
+
+		return wantedCodec, nil
+	}
+
+	return webrtc.RTPCodecParameters{}, errors.New(strings.Join(errReasons, "\n\n"))
+}
+
+func (t *ATrack) Unbind(ctx webrtc.TrackLocalContext) error {
+	t.mu.Lock()
+	stopChan := t.stopChan
+	stoppedChan := t.stoppedChan
+	encoder := t.encoder
+	t.stopChan = nil
+	t.mu.Unlock()
+
+	if stopChan == nil {
+		return nil
+	}
+
+	close(stopChan)
+
+	// unblock the pending read
+	encoder.Close()
+
+	<-stoppedChan
+
+	return nil
+}
+
+func (t *ATrack) writeLoop(ctx webrtc.TrackLocalContext, mimeType string, packetizer rtp.Packetizer, clockRate uint32, stopChan chan struct{}, stoppedChan chan struct{}) {
+	defer close(stoppedChan)
+
+	lastFrame := time.Now()
+	writer := ctx.WriteStream()
+
+	for {
+		select {
+		case <-stopChan:
+			return
+		default:
+		}
+
+		t.applyPendingSettings(mimeType)
+
+		t.mu.Lock()
+		encoder := t.encoder
+		if t.isKeyFrameReq {
+			t.isKeyFrameReq = false
+			if c, ok := encoder.Controller().(codec.KeyFrameController); ok {
+				c.ForceKeyFrame()
+			}
+		}
+		t.mu.Unlock()
+
+		data, release, err := encoder.Read()
+
+		if err != nil {
+			select {
+			case <-stopChan:
+			default:
+				log.Println("Per-peer video encoder read error:", t.id, err)
+			}
+
+			return
+		}
+
+		now := time.Now()
+		samples := uint32(math.Round(float64(clockRate) * now.Sub(lastFrame).Seconds()))
+		lastFrame = now
+
+		pkts := packetizer.Packetize(data, samples)
+		release()
+
+		for _, pkt := range pkts {
+			_, err = writer.WriteRTP(&pkt.Header, pkt.Payload)
+
+			if err != nil {
+				log.Println("Per-peer video write RTP error:", t.id, err)
+				return
+			}
+		}
+	}
+}
+
+// applyPendingSettings is called from the write loop, so the encoder is never swapped in the middle of a read
+func (t *ATrack) applyPendingSettings(mimeType string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	// the encoder belongs to Unbind once the track is stopped
+	if t.pending == nil || t.stopChan == nil {
+		return
+	}
+
+	s := *t.pending
+
+	if s.scale == t.current.scale && s.frameRate == t.current.frameRate {
+		if c, ok := t.encoder.Controller().(codec.BitRateController); ok {
+			err := c.SetBitRate(s.bitRate)
+
+			if err == nil {
+				t.current = s
+				t.pending = nil
+				return
+			}
+
+			log.Println("Per-peer video encoder SetBitRate error:", t.id, err)
+		}
+	}
+
+	if time.Since(t.lastRebuild) < rebuildInterval {
+		return
+	}
+
+	builder, err := t.config.NewEncoder(mimeType, s.bitRate)
+
+	if err != nil {
+		log.Println("Per-peer video encoder params error:", t.id, err)
+		t.pending = nil
+		return
+	}
+
+	encoder, err := t.buildEncoder(builder, s)
+
+	t.lastRebuild = time.Now()
+
+	if err != nil {
+		log.Println("Per-peer video encoder rebuild error:", t.id, err)
+		t.pending = nil
+		return
+	}
+
+	t.encoder.Close()
+	t.encoder = encoder
+	t.current = s
+	t.pending = nil
+}
+
+func (t *ATrack) rtcpLoop(reader interceptor.RTCPReader) {
+	buf := make([]byte, rtcpInboundMTU)
+
+	for {
+		n, _, err := reader.Read(buf, interceptor.Attributes{})
+
+		if err != nil {
+			if !errors.Is(err, io.EOF) {
+				log.Println("Per-peer video read RTCP error:", t.id, err)
+			}
+			return
+		}
+
+		pkts, err := rtcp.Unmarshal(buf[:n])
+
+		if err != nil {
+			continue
+		}
+
+		for _, pkt := range pkts {
+			switch p := pkt.(type) {
+			case *rtcp.PictureLossIndication, *rtcp.FullIntraRequest:
+				t.mu.Lock()
+				t.isKeyFrameReq = true
+				t.mu.Unlock()
+
+			case *rtcp.ReceiverEstimatedMaximumBitrate:
+				t.mu.Lock()
+				t.remb = int(p.Bitrate)
+				t.mu.Unlock()
+			}
+		}
+	}
+}
+
+// targetSettings maps the available bandwidth to the encoder settings within configured bounds
+func (t *ATrack) targetSettings(estimated int) encoderSettings {
+	bitRate := estimated
+
+	if bitRate > t.config.MaxBitRate {
+		bitRate = t.config.MaxBitRate
+	}
+
+	if bitRate < t.config.MinBitRate {
+		bitRate = t.config.MinBitRate
+	}
+
+	s := encoderSettings{bitRate: bitRate, scale: 1}
+	ratio := float64(bitRate) / float64(t.config.MaxBitRate)
+
+	if t.config.IsAdaptiveResolution {
+		if ratio < 0.5 {
+			s.scale = 2
+		}
+
+		if ratio < 0.2 {
+			s.scale = 4
+		}
+	}
+
+	if t.config.IsAdaptiveFrameRate && ratio < 0.3 && t.inputProp.FrameRate > 0 {
+		s.frameRate = math.Max(float64(t.inputProp.FrameRate)/2, 5)
+	}
+
+	if t.quality != QualityAuto {
+		// fixed quality keeps the resolution regardless of the bandwidth, only the bitrate is capped
+		s.scale = qualityScales[t.quality]
+
+		if capped := t.config.MaxBitRate / s.scale; s.bitRate > capped && capped >= t.config.MinBitRate {
+			s.bitRate = capped
+		}
+	}
+
+	return s
+}
+
+func (t *ATrack) controlLoop(stopChan chan struct{}) {
+	ticker := time.NewTicker(controlInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stopChan:
+			return
+
+		case <-ticker.C:
+		}
+
+		t.mu.Lock()
+
+		estimated := t.config.MaxBitRate
+
+		if t.estimator != nil {
+			estimated = t.estimator.GetTargetBitrate()
+		}
+
+		if t.remb > 0 && t.remb < estimated {
+			estimated = t.remb
+		}
+
+		target := t.targetSettings(estimated)
+		current := t.current
+
+		if t.pending != nil {
+			current = *t.pending
+		}
+
+		diff := math.Abs(float64(target.bitRate-current.bitRate)) / float64(current.bitRate)
+		isChanged := diff > bitRateHysteresis || target.scale != current.scale || target.frameRate != current.frameRate
+
+		quality := t.quality
+
+		if isChanged {
+			log.Println("Per-peer video encoder target:", t.id,
+				"quality:", quality,
+				"estimated:", estimated,
+				"bitrate:", current.bitRate, "->", target.bitRate,
+				"scale:", current.scale, "->", target.scale,
+				"frame rate:", current.frameRate, "->", target.frameRate,
+			)
+
+			t.pending = &target
+		}
+
+		t.mu.Unlock()
+
+		if isChanged && t.onStats != nil {
+			t.onStats(Stats{
+				Quality:          quality,
+				BitRate:          target.bitRate,
+				EstimatedBitRate: estimated,
+				Scale:            target.scale,
+				FrameRate:        target.frameRate,
+			})
+		}
+	}
+}
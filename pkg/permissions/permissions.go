@@ -0,0 +1,278 @@
+package permissions
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"math"
+	"strings"
+	"time"
+
+	jwt "github.com/golang-jwt/jwt"
+)
+
+var (
+	ErrTokenRequired  = errors.New("operator token required")
+	ErrSessionExpired = errors.New("session expired")
+)
+
+// Claims of the per-session operator token
+type Claims struct {
+	// AllowedTypes lists data channel message types the operator may send, empty list allows all
+	AllowedTypes []string `json:"allowedTypes"`
+	// AllowedKeys lists control keys the operator may send, empty list allows all
+	AllowedKeys []string `json:"allowedKeys"`
+	// SpeedCaps limits absolute numeric value of the control keys
+	SpeedCaps map[string]float64 `json:"speedCaps"`
+	// CanSwitchCamera grants 'SWITCH_CAMERA' and 'SET_VIDEO_TRACK' messages
+	CanSwitchCamera bool `json:"canSwitchCamera"`
+	// CanRecord grants 'START_RECORDING' and 'STOP_RECORDING' messages
+	CanRecord bool `json:"canRecord"`
+	jwt.StandardClaims
+}
+
+type Verifier struct {
+	secret     []byte
+	publicKey  interface{}
+	isRequired bool
+}
+
+type InitParams struct {
+	Secret        string
+	PublicKeyPath string
+	IsRequired    bool
+}
+
+func Factory(p InitParams) (*Verifier, error) {
+	v := &Verifier{
+		secret:     []byte(p.Secret),
+		isRequired: p.IsRequired,
+	}
+
+	if p.PublicKeyPath != "" {
+		pem, err := ioutil.ReadFile(p.PublicKeyPath)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if key, err := jwt.ParseRSAPublicKeyFromPEM(pem); err == nil {
+			v.publicKey = key
+		} else if key, err := jwt.ParseECPublicKeyFromPEM(pem); err == nil {
+			v.publicKey = key
+		} else {
+			return nil, fmt.Errorf("unsupported operator token public key: %s", p.PublicKeyPath)
+		}
+	}
+
+	if len(v.secret) == 0 && v.publicKey == nil && v.isRequired {
+		return nil, errors.New("operator token is required but neither secret nor public key is set")
+	}
+
+	return v, nil
+}
+
+// Verify checks the token signature and returns its claims.
+// Nil claims without error mean there is no token and the operator is not restricted.
+func (v *Verifier) Verify(tokenString string) (*Claims, error) {
+	if v == nil || (len(v.secret) == 0 && v.publicKey == nil) {
+		return nil, nil
+	}
+
+	if tokenString == "" {
+		if v.isRequired {
+			return nil, ErrTokenRequired
+		}
+
+		return nil, nil
+	}
+
+	claims := &Claims{}
+
+	_, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		switch token.Method.(type) {
+		case *jwt.SigningMethodHMAC:
+			if len(v.secret) > 0 {
+				return v.secret, nil
+			}
+
+		case *jwt.SigningMethodRSA, *jwt.SigningMethodECDSA:
+			if v.publicKey != nil {
+				return v.publicKey, nil
+			}
+		}
+
+		return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return claims, nil
+}
+
+// ExpiresIn returns the session time left, ok is false for sessions without expiry
+func (c *Claims) ExpiresIn() (time.Duration, bool) {
+	if c == nil || c.ExpiresAt == 0 {
+		return 0, false
+	}
+
+	return time.Until(time.Unix(c.ExpiresAt, 0)), true
+}
+
+func (c *Claims) isTypeAllowed(msgType string) bool {
+	if (msgType == "SWITCH_CAMERA" || msgType == "SET_VIDEO_TRACK") && !c.CanSwitchCamera {
+		return false
+	}
+
+	if (msgType == "START_RECORDING" || msgType == "STOP_RECORDING") && !c.CanRecord {
+		return false
+	}
+
+	if len(c.AllowedTypes) == 0 {
+		return true
+	}
+
+	for _, t := range c.AllowedTypes {
+		if t == msgType {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (c *Claims) isKeyAllowed(key string) bool {
+	if len(c.AllowedKeys) == 0 {
+		return true
+	}
+
+	for _, k := range c.AllowedKeys {
+		if k == key {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Enforce checks the data channel message against the claims.
+// 'CONTROLS' payload is filtered by allowed keys and speed caps, so the message could be rewritten.
+func (c *Claims) Enforce(msgType string, message []byte) ([]byte, error) {
+	if c == nil {
+		return message, nil
+	}
+
+	if !c.VerifyExpiresAt(time.Now().Unix(), false) {
+		return nil, ErrSessionExpired
+	}
+
+	if !c.isTypeAllowed(msgType) {
+		return nil, fmt.Errorf("message type %s is not allowed", msgType)
+	}
+
+	if msgType != "CONTROLS" || !c.isControlsRestricted() {
+		return message, nil
+	}
+
+	var envelope map[string]json.RawMessage
+
+	err := json.Unmarshal(message, &envelope)
+
+	if err != nil {
+		return nil, err
+	}
+
+	for field, raw := range envelope {
+		if !strings.EqualFold(field, "payload") {
+			continue
+		}
+
+		var payload string
+
+		err := json.Unmarshal(raw, &payload)
+
+		if err != nil {
+			return nil, err
+		}
+
+		filtered, err := c.FilterControls(payload)
+
+		if err != nil {
+			return nil, err
+		}
+
+		envelope[field], err = json.Marshal(filtered)
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return json.Marshal(envelope)
+}
+
+func (c *Claims) isControlsRestricted() bool {
+	return len(c.AllowedKeys) > 0 || len(c.SpeedCaps) > 0
+}
+
+// FilterControls applies allowed keys and speed caps to the controls payload, e.g. of the macro steps
+func (c *Claims) FilterControls(payload string) (string, error) {
+	if c == nil || !c.isControlsRestricted() {
+		return payload, nil
+	}
+
+	var controls map[string]interface{}
+
+	decoder := json.NewDecoder(bytes.NewReader([]byte(payload)))
+	decoder.UseNumber()
+
+	err := decoder.Decode(&controls)
+
+	if err != nil {
+		return "", err
+	}
+
+	for key, value := range controls {
+		if !c.isKeyAllowed(key) {
+			log.Println("Control key is not allowed:", key)
+			delete(controls, key)
+			continue
+		}
+
+		limit, ok := c.SpeedCaps[key]
+
+		if !ok {
+			continue
+		}
+
+		// a capped key could not get past the cap as a string or a nested object
+		number, isNumber := value.(json.Number)
+
+		if !isNumber {
+			return "", fmt.Errorf("control key %s should be a number", key)
+		}
+
+		v, err := number.Float64()
+
+		if err != nil {
+			return "", fmt.Errorf("control key %s should be a number: %v", key, err)
+		}
+
+		if math.Abs(v) > limit {
+			controls[key] = math.Copysign(limit, v)
+		}
+	}
+
+	if len(controls) == 0 {
+		return "", errors.New("no allowed control keys")
+	}
+
+	filtered, err := json.Marshal(controls)
+
+	return string(filtered), err
+}
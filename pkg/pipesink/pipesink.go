@@ -0,0 +1,201 @@
+// Package pipesink writes the decoded operator audio to a named pipe, Unix socket or child process stdin,
+// e.g. for speech recognition
+package pipesink
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+
+	"github.com/faiface/beep"
+	"github.com/roboportal/bot_box/pkg/pipesource"
+)
+
+const (
+	// SampleRate of the written audio, the samples are mono signed 16-bit little-endian
+	SampleRate = 48000
+
+	// queueSize of the chunks waiting for a slow consumer, the newer chunks are dropped when it is full
+	queueSize = 100
+)
+
+type Params struct {
+	// Type is one of fifo, unix, process
+	Type string
+	// Path is the named pipe or the socket path, or the shell command for the process
+	Path              string
+	RestartTimeoutSec int
+}
+
+func (p Params) IsEnabled() bool {
+	return p.Path != ""
+}
+
+func (p Params) Validate() error {
+	if !p.IsEnabled() {
+		return nil
+	}
+
+	switch p.Type {
+	case pipesource.TypeFifo, pipesource.TypeUnix, pipesource.TypeProcess:
+	default:
+		return fmt.Errorf("unknown audio sink type: %s", p.Type)
+	}
+
+	return nil
+}
+
+// ASink is shared by the sessions of all the bots, only one session writes to it at a time
+type ASink struct {
+	params  Params
+	chunks  chan []byte
+	mu      sync.Mutex
+	isInUse bool
+}
+
+// Start connects to the downstream in the background, it is reconnected whenever writing fails
+func Start(p Params) *ASink {
+	s := &ASink{params: p, chunks: make(chan []byte, queueSize)}
+
+	go s.run()
+
+	return s
+}
+
+// open connects to the downstream, the process is killed when the returned writer is closed
+func (s *ASink) open() (io.WriteCloser, error) {
+	switch s.params.Type {
+	case pipesource.TypeUnix:
+		return net.Dial("unix", s.params.Path)
+
+	case pipesource.TypeProcess:
+		cmd := exec.Command("sh", "-c", s.params.Path)
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+
+		stdin, err := cmd.StdinPipe()
+
+		if err != nil {
+			return nil, err
+		}
+
+		err = cmd.Start()
+
+		if err != nil {
+			return nil, err
+		}
+
+		go func() {
+			err := cmd.Wait()
+			log.Println("Audio sink: process exited", err)
+		}()
+
+		return &aProcess{WriteCloser: stdin, cmd: cmd}, nil
+
+	default:
+		// blocks until the consumer opens the pipe for reading
+		return os.OpenFile(s.params.Path, os.O_WRONLY, 0)
+	}
+}
+
+type aProcess struct {
+	io.WriteCloser
+	cmd *exec.Cmd
+}
+
+func (p *aProcess) Close() error {
+	p.cmd.Process.Kill()
+	return p.WriteCloser.Close()
+}
+
+func (s *ASink) run() {
+	for {
+		w, err := s.open()
+
+		if err == nil {
+			log.Println("Audio sink: writing", s.params.Type, s.params.Path)
+
+			// the audio queued while disconnected is stale
+			for len(s.chunks) > 0 {
+				<-s.chunks
+			}
+
+			for chunk := range s.chunks {
+				_, err = w.Write(chunk)
+
+				if err != nil {
+					break
+				}
+			}
+
+			w.Close()
+		}
+
+		log.Println("Audio sink: downstream failed, restarting", err)
+
+		time.Sleep(time.Duration(s.params.RestartTimeoutSec) * time.Second)
+	}
+}
+
+func (s *ASink) write(samples [][2]float64) {
+	data := make([]byte, len(samples)*2)
+
+	for i, sample := range samples {
+		value := math.Max(-1, math.Min(1, sample[0]))
+		binary.LittleEndian.PutUint16(data[i*2:], uint16(int16(value*32767)))
+	}
+
+	select {
+	case s.chunks <- data:
+	default:
+	}
+}
+
+// Tee copies the operator audio decoded at SampleRate to the sink while it is streamed,
+// false is returned when another session holds the sink
+func (s *ASink) Tee(streamer beep.Streamer) (beep.Streamer, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.isInUse {
+		return streamer, false
+	}
+
+	s.isInUse = true
+
+	return &aTee{sink: s, streamer: streamer}, true
+}
+
+// Release lets another session write to the sink
+func (s *ASink) Release() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.isInUse = false
+}
+
+type aTee struct {
+	sink     *ASink
+	streamer beep.Streamer
+}
+
+func (t *aTee) Stream(samples [][2]float64) (int, bool) {
+	n, ok := t.streamer.Stream(samples)
+
+	if n > 0 {
+		t.sink.write(samples[:n])
+	}
+
+	return n, ok
+}
+
+func (t *aTee) Err() error {
+	return t.streamer.Err()
+}
@@ -0,0 +1,353 @@
+package pipesource
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"log"
+	"time"
+
+	"github.com/pion/mediadevices/pkg/driver"
+	"github.com/pion/mediadevices/pkg/io/audio"
+	"github.com/pion/mediadevices/pkg/prop"
+	"github.com/pion/mediadevices/pkg/wave"
+)
+
+const (
+	// FormatS16LE is the only audio pipe format: interleaved signed 16-bit little-endian samples
+	FormatS16LE = "s16le"
+
+	audioFrameDuration = 20 * time.Millisecond
+	// audioQueueSize of 20ms frames read ahead, a faster producer is blocked by the pipe, e.g. text-to-speech
+	audioQueueSize = 10
+)
+
+type AudioParams struct {
+	// Type is one of fifo, unix, process
+	Type string
+	// Path is the named pipe or the socket path, or the shell command for the process
+	Path string
+	// SampleRate is one of the Opus sample rates: 8000, 12000, 16000, 24000 or 48000
+	SampleRate int
+	Channels   int
+	// IsMixed mixes the pipe audio into the microphone instead of replacing it
+	IsMixed           bool
+	RestartTimeoutSec int
+}
+
+func (p AudioParams) Validate() error {
+	switch p.Type {
+	case TypeFifo, TypeUnix, TypeProcess:
+	default:
+		return fmt.Errorf("unknown audio pipe type: %s", p.Type)
+	}
+
+	if p.Path == "" {
+		return fmt.Errorf("audio pipe path is not set")
+	}
+
+	switch p.SampleRate {
+	case 8000, 12000, 16000, 24000, 48000:
+	default:
+		return fmt.Errorf("audio pipe sample rate should be one of 8000, 12000, 16000, 24000, 48000: %d", p.SampleRate)
+	}
+
+	if p.Channels != 1 && p.Channels != 2 {
+		return fmt.Errorf("audio pipe channels should be 1 or 2: %d", p.Channels)
+	}
+
+	return nil
+}
+
+func (p AudioParams) pipe() Params {
+	return Params{Type: p.Type, Path: p.Path, Format: FormatS16LE, RestartTimeoutSec: p.RestartTimeoutSec}
+}
+
+type audioPipe struct {
+	params     AudioParams
+	frames     chan []int16
+	pending    []int16
+	microphone driver.Driver
+	closed     <-chan struct{}
+	cancel     func()
+}
+
+// RegisterAudio adds the pipe audio as a microphone, the samples are encoded by the regular audio pipeline
+func RegisterAudio(p AudioParams) {
+	driver.GetManager().Register(
+		&audioPipe{params: p},
+		driver.Info{Label: Label, DeviceType: driver.Microphone, Priority: driver.PriorityLow},
+	)
+}
+
+// findMicrophone returns the system default microphone, the generated and the pipe sources have low priority
+func findMicrophone() (driver.Driver, error) {
+	var microphone driver.Driver
+
+	for _, d := range driver.GetManager().Query(driver.FilterDeviceType(driver.Microphone)) {
+		if d.Info().Priority == driver.PriorityLow {
+			continue
+		}
+
+		if microphone == nil || d.Info().Priority > microphone.Info().Priority {
+			microphone = d
+		}
+	}
+
+	if microphone == nil {
+		return nil, fmt.Errorf("no microphone to mix the audio pipe into")
+	}
+
+	return microphone, nil
+}
+
+func (a *audioPipe) Open() error {
+	if a.params.IsMixed {
+		microphone, err := findMicrophone()
+
+		if err != nil {
+			return err
+		}
+
+		err = microphone.Open()
+
+		if err != nil {
+			return err
+		}
+
+		log.Println("Audio pipe: mixing into", microphone.Info().Label)
+
+		a.microphone = microphone
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	a.closed = ctx.Done()
+	a.cancel = cancel
+	a.frames = make(chan []int16, audioQueueSize)
+
+	go run(ctx, a.params.pipe(), a.readFrames)
+
+	return nil
+}
+
+func (a *audioPipe) Close() error {
+	a.cancel()
+
+	if a.microphone != nil {
+		return a.microphone.Close()
+	}
+
+	return nil
+}
+
+func (a *audioPipe) Properties() []prop.Media {
+	return []prop.Media{
+		{
+			Audio: prop.Audio{
+				SampleRate:   a.params.SampleRate,
+				Latency:      audioFrameDuration,
+				ChannelCount: a.params.Channels,
+			},
+		},
+	}
+}
+
+func (a *audioPipe) readFrames(stream io.Reader) error {
+	size := a.params.SampleRate * a.params.Channels * int(audioFrameDuration/time.Millisecond) / 1000
+
+	for {
+		frame := make([]int16, size)
+
+		err := binary.Read(stream, binary.LittleEndian, frame)
+
+		if err != nil {
+			return err
+		}
+
+		select {
+		case a.frames <- frame:
+		case <-a.closed:
+			return io.EOF
+		}
+	}
+}
+
+// take returns the next interleaved samples, the missing ones are silent, so the track keeps running while
+// the producer is idle
+func (a *audioPipe) take(size int) []int16 {
+	isQueueEmpty := false
+
+	for len(a.pending) < size && !isQueueEmpty {
+		select {
+		case frame := <-a.frames:
+			a.pending = append(a.pending, frame...)
+		default:
+			isQueueEmpty = true
+		}
+	}
+
+	samples := make([]int16, size)
+	n := copy(samples, a.pending)
+	a.pending = a.pending[n:]
+
+	return samples
+}
+
+func clamp(value int) wave.Int16Sample {
+	if value > 32767 {
+		return 32767
+	}
+
+	if value < -32768 {
+		return -32768
+	}
+
+	return wave.Int16Sample(value)
+}
+
+func (a *audioPipe) AudioRecord(p prop.Media) (audio.Reader, error) {
+	if a.microphone != nil {
+		return a.mixedRecord(p)
+	}
+
+	if p.Latency == 0 {
+		p.Latency = audioFrameDuration
+	}
+
+	samples := int(uint64(p.SampleRate) * uint64(p.Latency) / uint64(time.Second))
+	nextReadTime := time.Now()
+	closed := a.closed
+
+	reader := audio.ReaderFunc(func() (wave.Audio, func(), error) {
+		select {
+		case <-closed:
+			return nil, func() {}, io.EOF
+		default:
+		}
+
+		time.Sleep(time.Until(nextReadTime))
+		nextReadTime = nextReadTime.Add(p.Latency)
+
+		chunk := wave.NewInt16Interleaved(
+			wave.ChunkInfo{
+				Channels:     p.ChannelCount,
+				Len:          samples,
+				SamplingRate: p.SampleRate,
+			},
+		)
+
+		copy(chunk.Data, a.take(samples*p.ChannelCount))
+
+		return chunk, func() {}, nil
+	})
+
+	return reader, nil
+}
+
+// mixedRecord adds the pipe samples to the microphone chunks, the microphone paces the track
+func (a *audioPipe) mixedRecord(p prop.Media) (audio.Reader, error) {
+	recorder, ok := a.microphone.(driver.AudioRecorder)
+
+	if !ok {
+		return nil, fmt.Errorf("microphone could not be recorded: %s", a.microphone.Info().Label)
+	}
+
+	microphoneReader, err := recorder.AudioRecord(p)
+
+	if err != nil {
+		return nil, err
+	}
+
+	r := &aResampler{rate: a.params.SampleRate, channels: a.params.Channels}
+
+	reader := audio.ReaderFunc(func() (wave.Audio, func(), error) {
+		input, release, err := microphoneReader.Read()
+
+		if err != nil {
+			return nil, func() {}, err
+		}
+
+		defer release()
+
+		info := input.ChunkInfo()
+		chunk := wave.NewInt16Interleaved(info)
+
+		frames := r.frames(info)
+		samples := a.take(frames * r.channels)
+
+		for i := 0; i < info.Len; i++ {
+			for ch := 0; ch < info.Channels; ch++ {
+				value := wave.Int16SampleFormat.Convert(input.At(i, ch)).(wave.Int16Sample)
+				chunk.SetInt16(i, ch, clamp(int(value)+r.at(samples, frames, i, ch, info)))
+			}
+		}
+
+		return chunk, func() {}, nil
+	})
+
+	return reader, nil
+}
+
+// aResampler converts the pipe samples to the sample rate and the channels of the microphone chunks,
+// the microphone could not be opened with the pipe format, e.g. 48000 stereo of PulseAudio with 16000 mono of TTS
+type aResampler struct {
+	rate     int
+	channels int
+	// inputRate of the microphone and the number of its samples mixed so far
+	inputRate int
+	mixed     uint64
+}
+
+// frames returns the number of the pipe frames for the microphone chunk, the remainders are carried over to
+// the next chunks, so the pipe is consumed at its own rate
+func (r *aResampler) frames(info wave.ChunkInfo) int {
+	if info.SamplingRate <= 0 {
+		return info.Len
+	}
+
+	if info.SamplingRate != r.inputRate {
+		r.inputRate = info.SamplingRate
+		r.mixed = 0
+	}
+
+	from := r.mixed * uint64(r.rate) / uint64(r.inputRate)
+	r.mixed += uint64(info.Len)
+
+	return int(r.mixed*uint64(r.rate)/uint64(r.inputRate) - from)
+}
+
+// sample of the pipe frame for the microphone channel, stereo is averaged for mono and mono is duplicated for stereo
+func (r *aResampler) sample(samples []int16, frame int, ch int, channels int) int {
+	if r.channels > 1 && channels == 1 {
+		sum := 0
+
+		for c := 0; c < r.channels; c++ {
+			sum += int(samples[frame*r.channels+c])
+		}
+
+		return sum / r.channels
+	}
+
+	return int(samples[frame*r.channels+ch%r.channels])
+}
+
+// at interpolates the pipe frames linearly at the position of the microphone sample i
+func (r *aResampler) at(samples []int16, frames int, i int, ch int, info wave.ChunkInfo) int {
+	if frames == 0 {
+		return 0
+	}
+
+	position := float64(i) * float64(frames) / float64(info.Len)
+	frame := int(position)
+	next := frame + 1
+
+	if next >= frames {
+		next = frames - 1
+	}
+
+	current := r.sample(samples, frame, ch, info.Channels)
+	fraction := position - float64(frame)
+
+	return current + int(fraction*float64(r.sample(samples, next, ch, info.Channels)-current))
+}
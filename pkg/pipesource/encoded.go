@@ -0,0 +1,137 @@
+package pipesource
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/pion/webrtc/v3"
+	"github.com/pion/webrtc/v3/pkg/media"
+	"github.com/pion/webrtc/v3/pkg/media/h264reader"
+	"github.com/pion/webrtc/v3/pkg/media/ivfreader"
+)
+
+var ivfMimeTypes = map[string]string{
+	"VP80": webrtc.MimeTypeVP8,
+	"VP90": webrtc.MimeTypeVP9,
+}
+
+// EncodedTrack forwards already encoded frames to every peer connection without transcoding
+type EncodedTrack struct {
+	*webrtc.TrackLocalStaticSample
+	params Params
+	cancel func()
+}
+
+// MimeType of the encoded stream, IVF streams carry VP8 unless 'vp9' codec is set
+func (p Params) MimeType() string {
+	if p.Format == FormatH264 {
+		return webrtc.MimeTypeH264
+	}
+
+	if p.Codec == "vp9" {
+		return webrtc.MimeTypeVP9
+	}
+
+	return webrtc.MimeTypeVP8
+}
+
+// NewEncodedTrack starts reading the upstream, the track should be closed with Stop
+func NewEncodedTrack(p Params, id string) (*EncodedTrack, error) {
+	track, err := webrtc.NewTrackLocalStaticSample(webrtc.RTPCodecCapability{MimeType: p.MimeType(), ClockRate: 90000}, id, Label)
+
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	t := &EncodedTrack{TrackLocalStaticSample: track, params: p, cancel: cancel}
+
+	if p.Format == FormatH264 {
+		go run(ctx, p, t.readH264)
+	} else {
+		go run(ctx, p, t.readIVF)
+	}
+
+	return t, nil
+}
+
+func (t *EncodedTrack) Stop() {
+	t.cancel()
+}
+
+// readIVF keeps the original frame timing, so a file could be streamed as well as a live pipeline
+func (t *EncodedTrack) readIVF(stream io.Reader) error {
+	reader, header, err := ivfreader.NewWith(stream)
+
+	if err != nil {
+		return err
+	}
+
+	if mimeType, ok := ivfMimeTypes[header.FourCC]; !ok || mimeType != t.params.MimeType() {
+		return fmt.Errorf("IVF stream codec %s doesn't match the track %s", header.FourCC, t.params.MimeType())
+	}
+
+	timebase := time.Second * time.Duration(header.TimebaseNumerator) / time.Duration(header.TimebaseDenominator)
+	start := time.Now()
+	var previous uint64
+
+	for {
+		frame, frameHeader, err := reader.ParseNextFrame()
+
+		if err != nil {
+			return err
+		}
+
+		time.Sleep(time.Until(start.Add(time.Duration(frameHeader.Timestamp) * timebase)))
+
+		duration := time.Duration(frameHeader.Timestamp-previous) * timebase
+		previous = frameHeader.Timestamp
+
+		err = t.WriteSample(media.Sample{Data: frame, Duration: duration})
+
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// readH264 forwards NAL units as they come, the producer is expected to run in real time
+func (t *EncodedTrack) readH264(stream io.Reader) error {
+	reader, err := h264reader.NewReader(stream)
+
+	if err != nil {
+		return err
+	}
+
+	frameRate := t.params.FrameRate
+
+	if frameRate <= 0 {
+		frameRate = 30
+	}
+
+	frameDuration := time.Duration(float64(time.Second) / frameRate)
+
+	for {
+		nal, err := reader.NextNAL()
+
+		if err != nil {
+			return err
+		}
+
+		// only picture slices advance the timestamp, parameter sets belong to the following frame
+		duration := time.Duration(0)
+
+		if nal.UnitType == h264reader.NalUnitTypeCodedSliceIdr || nal.UnitType == h264reader.NalUnitTypeCodedSliceNonIdr {
+			duration = frameDuration
+		}
+
+		err = t.WriteSample(media.Sample{Data: nal.Data, Duration: duration})
+
+		if err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,161 @@
+// Package pipesource reads video produced by an external pipeline from a named pipe, Unix socket or child process stdout
+package pipesource
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"os/exec"
+	"time"
+)
+
+const (
+	// Label is the device label of the raw frames source, could be used in place of a camera device
+	Label = "pipe"
+
+	TypeFifo    = "fifo"
+	TypeUnix    = "unix"
+	TypeProcess = "process"
+
+	FormatI420  = "i420"
+	FormatRGB24 = "rgb24"
+	FormatRGBA  = "rgba"
+	FormatIVF   = "ivf"
+	FormatH264  = "h264"
+)
+
+type Params struct {
+	// Type is one of fifo, unix, process
+	Type string
+	// Path is the named pipe or the socket path, or the shell command for the process
+	Path string
+	// Format is one of i420, rgb24, rgba for raw frames or ivf, h264 for encoded stream
+	Format string
+	// Codec of the IVF stream: vp8 or vp9
+	Codec             string
+	Width             int
+	Height            int
+	FrameRate         float64
+	RestartTimeoutSec int
+}
+
+func (p Params) IsEncoded() bool {
+	return p.Format == FormatIVF || p.Format == FormatH264
+}
+
+func (p Params) Validate() error {
+	switch p.Type {
+	case TypeFifo, TypeUnix, TypeProcess:
+	default:
+		return fmt.Errorf("unknown pipe type: %s", p.Type)
+	}
+
+	switch p.Format {
+	case FormatIVF, FormatH264:
+	case FormatI420, FormatRGB24, FormatRGBA:
+		if p.Width <= 0 || p.Height <= 0 {
+			return fmt.Errorf("frame size should be set for %s pipe format", p.Format)
+		}
+
+		if p.Format == FormatI420 && (p.Width%2 != 0 || p.Height%2 != 0) {
+			return fmt.Errorf("frame size should be even for %s pipe format", p.Format)
+		}
+	default:
+		return fmt.Errorf("unknown pipe format: %s", p.Format)
+	}
+
+	if p.Path == "" {
+		return fmt.Errorf("pipe path is not set")
+	}
+
+	return nil
+}
+
+// open connects to the upstream, the returned reader is closed when the context is done
+func open(ctx context.Context, p Params) (io.ReadCloser, error) {
+	var stream io.ReadCloser
+
+	switch p.Type {
+	case TypeFifo:
+		f, err := os.Open(p.Path)
+
+		if err != nil {
+			return nil, err
+		}
+
+		stream = f
+
+	case TypeUnix:
+		conn, err := net.Dial("unix", p.Path)
+
+		if err != nil {
+			return nil, err
+		}
+
+		stream = conn
+
+	case TypeProcess:
+		cmd := exec.CommandContext(ctx, "sh", "-c", p.Path)
+		cmd.Stderr = os.Stderr
+
+		stdout, err := cmd.StdoutPipe()
+
+		if err != nil {
+			return nil, err
+		}
+
+		err = cmd.Start()
+
+		if err != nil {
+			return nil, err
+		}
+
+		go func() {
+			err := cmd.Wait()
+			log.Println("Pipe source: process exited", err)
+		}()
+
+		stream = stdout
+	}
+
+	go func() {
+		<-ctx.Done()
+		stream.Close()
+	}()
+
+	return stream, nil
+}
+
+// run reads the upstream with the handler until the context is done, reconnecting after failures
+func run(ctx context.Context, p Params, handle func(io.Reader) error) {
+	for {
+		connCtx, cancel := context.WithCancel(ctx)
+
+		stream, err := open(connCtx, p)
+
+		if err == nil {
+			log.Println("Pipe source: reading", p.Type, p.Path, p.Format)
+
+			err = handle(stream)
+		}
+
+		cancel()
+
+		select {
+		case <-ctx.Done():
+			return
+		default:
+		}
+
+		log.Println("Pipe source: upstream failed, restarting", err)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Duration(p.RestartTimeoutSec) * time.Second):
+		}
+	}
+}
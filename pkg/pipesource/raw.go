@@ -0,0 +1,151 @@
+package pipesource
+
+import (
+	"context"
+	"image"
+	"io"
+
+	"github.com/pion/mediadevices/pkg/driver"
+	"github.com/pion/mediadevices/pkg/frame"
+	"github.com/pion/mediadevices/pkg/io/video"
+	"github.com/pion/mediadevices/pkg/prop"
+)
+
+type raw struct {
+	params Params
+	frames chan image.Image
+	closed <-chan struct{}
+	cancel func()
+}
+
+// RegisterRaw adds the raw frames source as a camera, frames are decoded and encoded by the regular video pipeline
+func RegisterRaw(p Params) {
+	driver.GetManager().Register(
+		&raw{params: p},
+		driver.Info{Label: Label, DeviceType: driver.Camera, Priority: driver.PriorityLow},
+	)
+}
+
+func (r *raw) Open() error {
+	ctx, cancel := context.WithCancel(context.Background())
+	r.closed = ctx.Done()
+	r.cancel = cancel
+	r.frames = make(chan image.Image, 1)
+
+	go run(ctx, r.params, r.readFrames)
+
+	return nil
+}
+
+func (r *raw) Close() error {
+	r.cancel()
+	return nil
+}
+
+func (r *raw) Properties() []prop.Media {
+	frameFormat := frame.FormatRGBA
+
+	if r.params.Format == FormatI420 {
+		frameFormat = frame.FormatI420
+	}
+
+	return []prop.Media{
+		{
+			Video: prop.Video{
+				Width:       r.params.Width,
+				Height:      r.params.Height,
+				FrameRate:   float32(r.params.FrameRate),
+				FrameFormat: frameFormat,
+			},
+		},
+	}
+}
+
+func (r *raw) frameSize() int {
+	pixels := r.params.Width * r.params.Height
+
+	switch r.params.Format {
+	case FormatI420:
+		return pixels * 3 / 2
+	case FormatRGB24:
+		return pixels * 3
+	default:
+		return pixels * 4
+	}
+}
+
+func (r *raw) decode(data []byte) image.Image {
+	w, h := r.params.Width, r.params.Height
+	rect := image.Rect(0, 0, w, h)
+
+	switch r.params.Format {
+	case FormatI420:
+		ySize := w * h
+		cSize := ySize / 4
+
+		return &image.YCbCr{
+			Y:              data[:ySize],
+			Cb:             data[ySize : ySize+cSize],
+			Cr:             data[ySize+cSize : ySize+2*cSize],
+			YStride:        w,
+			CStride:        w / 2,
+			SubsampleRatio: image.YCbCrSubsampleRatio420,
+			Rect:           rect,
+		}
+
+	case FormatRGB24:
+		img := image.NewRGBA(rect)
+
+		for i, j := 0, 0; i < len(data); i, j = i+3, j+4 {
+			img.Pix[j] = data[i]
+			img.Pix[j+1] = data[i+1]
+			img.Pix[j+2] = data[i+2]
+			img.Pix[j+3] = 255
+		}
+
+		return img
+
+	default:
+		return &image.RGBA{Pix: data, Stride: w * 4, Rect: rect}
+	}
+}
+
+// readFrames keeps draining the upstream, so a slow encoder drops frames instead of stalling the producer
+func (r *raw) readFrames(stream io.Reader) error {
+	size := r.frameSize()
+
+	for {
+		data := make([]byte, size)
+
+		_, err := io.ReadFull(stream, data)
+
+		if err != nil {
+			return err
+		}
+
+		img := r.decode(data)
+
+		select {
+		case <-r.frames:
+		default:
+		}
+
+		r.frames <- img
+	}
+}
+
+func (r *raw) VideoRecord(p prop.Media) (video.Reader, error) {
+	closed := r.closed
+	frames := r.frames
+
+	reader := video.ReaderFunc(func() (image.Image, func(), error) {
+		select {
+		case <-closed:
+			return nil, func() {}, io.EOF
+		case img := <-frames:
+			return img, func() {}, nil
+		}
+	})
+
+	return reader, nil
+}
@@ -0,0 +1,104 @@
+// Package recorder writes the media and the data channel events of operator sessions to disk
+package recorder
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+type Config struct {
+	IsEnabled bool
+	// IsAutoStart starts the recording with every operator session, otherwise it is started by the Client App
+	IsAutoStart bool
+	// Directory keeps a subdirectory per recording
+	Directory string
+	// MaxSizeMB is the quota of the directory, the oldest recordings are removed when it is exceeded, 0 - unlimited
+	MaxSizeMB int
+}
+
+func (c Config) Validate() error {
+	if !c.IsEnabled {
+		return nil
+	}
+
+	if c.Directory == "" {
+		return fmt.Errorf("recording directory is not set")
+	}
+
+	if c.MaxSizeMB < 0 {
+		return fmt.Errorf("recording quota should not be negative: %d", c.MaxSizeMB)
+	}
+
+	return nil
+}
+
+func getSize(path string) int64 {
+	var size int64
+
+	filepath.Walk(path, func(_ string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			size += info.Size()
+		}
+
+		return nil
+	})
+
+	return size
+}
+
+// enforceQuota removes the oldest recordings except the active one until the directory fits the quota,
+// false is returned when the active recording alone exceeds it
+func enforceQuota(c Config, active string) bool {
+	if c.MaxSizeMB == 0 {
+		return true
+	}
+
+	quota := int64(c.MaxSizeMB) * 1024 * 1024
+
+	entries, err := ioutil.ReadDir(c.Directory)
+
+	if err != nil {
+		log.Println("Read recordings directory error", err)
+		return true
+	}
+
+	// recording names start with the time, so the order of names is the order of recordings
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name() < entries[j].Name()
+	})
+
+	sizes := make([]int64, len(entries))
+	var total int64
+
+	for i, entry := range entries {
+		sizes[i] = getSize(filepath.Join(c.Directory, entry.Name()))
+		total += sizes[i]
+	}
+
+	for i, entry := range entries {
+		if total <= quota {
+			break
+		}
+
+		if !entry.IsDir() || entry.Name() == active {
+			continue
+		}
+
+		log.Println("Recording quota exceeded, removing:", entry.Name())
+
+		err := os.RemoveAll(filepath.Join(c.Directory, entry.Name()))
+
+		if err != nil {
+			log.Println("Remove recording error", err)
+			continue
+		}
+
+		total -= sizes[i]
+	}
+
+	return total <= quota
+}
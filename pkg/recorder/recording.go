@@ -0,0 +1,311 @@
+package recorder
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v3"
+	"github.com/pion/webrtc/v3/pkg/media/h264writer"
+	"github.com/pion/webrtc/v3/pkg/media/ivfwriter"
+	"github.com/pion/webrtc/v3/pkg/media/oggwriter"
+)
+
+const (
+	// quotaCheckInterval is how often the directory size is checked during the recording
+	quotaCheckInterval = 30 * time.Second
+	// queueSize of packets and events, the items are dropped when the disk could not keep up
+	queueSize = 1000
+)
+
+type rtpWriter interface {
+	WriteRTP(packet *rtp.Packet) error
+	Close() error
+}
+
+// Stream is a media file of the recording, StartedAt is the wall clock of the first packet
+// to align the file with the events
+type Stream struct {
+	Name      string    `json:"name"`
+	File      string    `json:"file,omitempty"`
+	MimeType  string    `json:"mimeType"`
+	StartedAt time.Time `json:"startedAt"`
+	writer    rtpWriter
+}
+
+type anItem struct {
+	key      string
+	name     string
+	mimeType string
+	channels uint16
+	packet   *rtp.Packet
+	event    []byte
+}
+
+// Recording is a directory with the media files, 'events.jsonl' and 'session.json' of a single session
+type Recording struct {
+	Name       string
+	BotID      int
+	StartedAt  time.Time
+	config     Config
+	directory  string
+	streams    map[string]*Stream
+	events     *os.File
+	queue      chan anItem
+	done       chan struct{}
+	mu         sync.Mutex
+	isStopped  bool
+	isDropping bool
+}
+
+// Start creates the recording directory, the oldest recordings are removed when the quota is exceeded
+func Start(c Config, botID int) (*Recording, error) {
+	now := time.Now()
+	name := fmt.Sprintf("%s_bot%d", now.Format("20060102-150405"), botID)
+	directory := filepath.Join(c.Directory, name)
+
+	err := os.MkdirAll(directory, 0755)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if !enforceQuota(c, name) {
+		os.RemoveAll(directory)
+		return nil, fmt.Errorf("recording quota of %dMB is exceeded", c.MaxSizeMB)
+	}
+
+	events, err := os.Create(filepath.Join(directory, "events.jsonl"))
+
+	if err != nil {
+		return nil, err
+	}
+
+	r := &Recording{
+		Name:      name,
+		BotID:     botID,
+		StartedAt: now,
+		config:    c,
+		directory: directory,
+		streams:   make(map[string]*Stream),
+		events:    events,
+		queue:     make(chan anItem, queueSize),
+		done:      make(chan struct{}),
+	}
+
+	log.Println("Recording started:", directory)
+
+	go r.run()
+
+	return r, nil
+}
+
+func (r *Recording) enqueue(item anItem) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.isStopped {
+		return
+	}
+
+	select {
+	case r.queue <- item:
+		r.isDropping = false
+	default:
+		if !r.isDropping {
+			log.Println("Recording queue is full, dropping:", r.Name)
+			r.isDropping = true
+		}
+	}
+}
+
+// LogEvent adds a line to 'events.jsonl', the message is kept as is when it is a valid JSON
+func (r *Recording) LogEvent(source string, message string) {
+	type anEvent struct {
+		Time    time.Time       `json:"time"`
+		Source  string          `json:"source"`
+		Message json.RawMessage `json:"message"`
+	}
+
+	raw := json.RawMessage(message)
+
+	if !json.Valid(raw) {
+		raw, _ = json.Marshal(message)
+	}
+
+	line, err := json.Marshal(anEvent{Time: time.Now(), Source: source, Message: raw})
+
+	if err != nil {
+		log.Println("Serialize recording event error", err)
+		return
+	}
+
+	r.enqueue(anItem{event: append(line, '\n')})
+}
+
+func (r *Recording) writeRTP(key string, name string, mimeType string, channels uint16, header *rtp.Header, payload []byte) {
+	packet := &rtp.Packet{Header: header.Clone(), Payload: append([]byte(nil), payload...)}
+
+	r.enqueue(anItem{key: key, name: name, mimeType: mimeType, channels: channels, packet: packet})
+}
+
+func (r *Recording) openStream(item anItem) *Stream {
+	var writer rtpWriter
+	var err error
+	var extension string
+
+	path := filepath.Join(r.directory, item.name)
+
+	switch strings.ToLower(item.mimeType) {
+	case strings.ToLower(webrtc.MimeTypeVP8):
+		extension = ".ivf"
+		writer, err = ivfwriter.New(path+extension, ivfwriter.WithCodec(webrtc.MimeTypeVP8))
+	case strings.ToLower(webrtc.MimeTypeVP9):
+		extension = ".ivf"
+		writer, err = newVP9Writer(path + extension)
+	case strings.ToLower(webrtc.MimeTypeH264):
+		extension = ".h264"
+		writer, err = h264writer.New(path + extension)
+	case strings.ToLower(webrtc.MimeTypeOpus):
+		channels := item.channels
+
+		if channels == 0 {
+			channels = 1
+		}
+
+		extension = ".ogg"
+		writer, err = oggwriter.New(path+extension, 48000, channels)
+	default:
+		err = fmt.Errorf("recording of %s is not supported", item.mimeType)
+	}
+
+	s := &Stream{Name: item.name, MimeType: item.mimeType, StartedAt: time.Now()}
+
+	if err != nil {
+		log.Println("Recording stream error:", item.name, err)
+		return s
+	}
+
+	s.File = item.name + extension
+	s.writer = writer
+
+	return s
+}
+
+func (r *Recording) run() {
+	defer close(r.done)
+
+	ticker := time.NewTicker(quotaCheckInterval)
+	defer ticker.Stop()
+
+	isQuotaExceeded := false
+
+	for {
+		select {
+		case <-ticker.C:
+			if !isQuotaExceeded && !enforceQuota(r.config, r.Name) {
+				log.Println("Recording quota exceeded, recording is paused:", r.Name)
+				isQuotaExceeded = true
+			}
+
+		case item, ok := <-r.queue:
+			if !ok {
+				return
+			}
+
+			if isQuotaExceeded {
+				continue
+			}
+
+			if item.event != nil {
+				_, err := r.events.Write(item.event)
+
+				if err != nil {
+					log.Println("Write recording event error", err)
+				}
+
+				continue
+			}
+
+			s, ok := r.streams[item.key]
+
+			if !ok {
+				s = r.openStream(item)
+				r.streams[item.key] = s
+			}
+
+			if s.writer == nil {
+				continue
+			}
+
+			err := s.writer.WriteRTP(item.packet)
+
+			if err != nil {
+				log.Println("Write recording stream error:", s.Name, err)
+			}
+		}
+	}
+}
+
+// Stop flushes the queue, closes the files and writes 'session.json'
+func (r *Recording) Stop() {
+	r.mu.Lock()
+
+	if r.isStopped {
+		r.mu.Unlock()
+		return
+	}
+
+	r.isStopped = true
+	close(r.queue)
+	r.mu.Unlock()
+
+	<-r.done
+
+	type aSession struct {
+		BotID     int       `json:"botId"`
+		StartedAt time.Time `json:"startedAt"`
+		StoppedAt time.Time `json:"stoppedAt"`
+		Streams   []*Stream `json:"streams"`
+	}
+
+	session := aSession{BotID: r.BotID, StartedAt: r.StartedAt, StoppedAt: time.Now(), Streams: make([]*Stream, 0)}
+
+	for _, s := range r.streams {
+		if s.writer != nil {
+			err := s.writer.Close()
+
+			if err != nil {
+				log.Println("Close recording stream error:", s.Name, err)
+			}
+		}
+
+		session.Streams = append(session.Streams, s)
+	}
+
+	sort.Slice(session.Streams, func(i, j int) bool {
+		return session.Streams[i].Name < session.Streams[j].Name
+	})
+
+	r.events.Close()
+
+	data, err := json.MarshalIndent(session, "", "  ")
+
+	if err == nil {
+		err = ioutil.WriteFile(filepath.Join(r.directory, "session.json"), data, 0644)
+	}
+
+	if err != nil {
+		log.Println("Write recording session error", err)
+	}
+
+	log.Println("Recording stopped:", r.directory)
+}
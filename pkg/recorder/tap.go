@@ -0,0 +1,109 @@
+package recorder
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/pion/interceptor"
+	"github.com/pion/rtp"
+)
+
+// Tap is the interceptor of a single peer connection feeding its RTP streams to the active recording.
+// Outgoing streams are tapped as they are written by the tracks, incoming streams as they are read by the application.
+type Tap struct {
+	interceptor.NoOp
+	mu        sync.Mutex
+	recording *Recording
+	names     map[uint32]string
+}
+
+// TapFactory creates a Tap for every new peer connection and pushes it to the channel,
+// it happens synchronously inside NewPeerConnection, so the bot could pick it right after the call
+type TapFactory struct {
+	tapChan chan *Tap
+}
+
+func NewTapFactory() (*TapFactory, chan *Tap) {
+	tapChan := make(chan *Tap, 1)
+
+	return &TapFactory{tapChan: tapChan}, tapChan
+}
+
+func (f *TapFactory) NewInterceptor(_ string) (interceptor.Interceptor, error) {
+	tap := &Tap{names: make(map[uint32]string)}
+
+	// drop the tap of a connection which was never picked up
+	select {
+	case <-f.tapChan:
+	default:
+	}
+
+	f.tapChan <- tap
+
+	return tap, nil
+}
+
+// SetRecording starts feeding the streams to the recording, nil stops it
+func (t *Tap) SetRecording(r *Recording) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.recording = r
+}
+
+// SetTrackName names the files of the outgoing stream
+func (t *Tap) SetTrackName(ssrc uint32, name string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.names[ssrc] = name
+}
+
+func (t *Tap) write(key string, name string, info *interceptor.StreamInfo, header *rtp.Header, payload []byte) {
+	t.mu.Lock()
+	recording := t.recording
+	t.mu.Unlock()
+
+	if recording != nil {
+		recording.writeRTP(key, name, info.MimeType, info.Channels, header, payload)
+	}
+}
+
+func (t *Tap) BindLocalStream(info *interceptor.StreamInfo, writer interceptor.RTPWriter) interceptor.RTPWriter {
+	key := fmt.Sprintf("out/%d", info.SSRC)
+
+	return interceptor.RTPWriterFunc(func(header *rtp.Header, payload []byte, attributes interceptor.Attributes) (int, error) {
+		t.mu.Lock()
+		name, ok := t.names[info.SSRC]
+		t.mu.Unlock()
+
+		if !ok {
+			name = fmt.Sprintf("out_%d", info.SSRC)
+		}
+
+		t.write(key, name, info, header, payload)
+
+		return writer.Write(header, payload, attributes)
+	})
+}
+
+func (t *Tap) BindRemoteStream(info *interceptor.StreamInfo, reader interceptor.RTPReader) interceptor.RTPReader {
+	key := fmt.Sprintf("in/%d", info.SSRC)
+	name := fmt.Sprintf("operator_%d", info.SSRC)
+
+	return interceptor.RTPReaderFunc(func(b []byte, a interceptor.Attributes) (int, interceptor.Attributes, error) {
+		n, attributes, err := reader.Read(b, a)
+
+		if err != nil {
+			return n, attributes, err
+		}
+
+		packet := &rtp.Packet{}
+
+		if packet.Unmarshal(b[:n]) == nil {
+			t.write(key, name, info, &packet.Header, packet.Payload)
+		}
+
+		return n, attributes, err
+	})
+}
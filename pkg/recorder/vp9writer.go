@@ -0,0 +1,129 @@
+package recorder
+
+import (
+	"encoding/binary"
+	"os"
+
+	"github.com/pion/rtp"
+	"github.com/pion/rtp/codecs"
+)
+
+const (
+	ivfHeaderSize = 32
+	// ivfTimeBase of the frame timestamps is the RTP video clock, so the pauses of the stream are kept
+	ivfTimeBase = 90000
+)
+
+// aVP9Writer writes VP9 frames to IVF file, ivfwriter of pion supports only VP8 and AV1.
+// The frames are written from the first key frame, a frame with a lost packet is skipped.
+type aVP9Writer struct {
+	file           *os.File
+	frame          []byte
+	isInFrame      bool
+	hasKeyFrame    bool
+	count          uint32
+	firstTimestamp uint32
+	width          uint16
+	height         uint16
+}
+
+func newVP9Writer(path string) (*aVP9Writer, error) {
+	file, err := os.Create(path)
+
+	if err != nil {
+		return nil, err
+	}
+
+	w := &aVP9Writer{file: file, width: 640, height: 480}
+
+	_, err = file.Write(w.header())
+
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	return w, nil
+}
+
+func (w *aVP9Writer) header() []byte {
+	header := make([]byte, ivfHeaderSize)
+
+	copy(header[0:], "DKIF")
+	binary.LittleEndian.PutUint16(header[6:], ivfHeaderSize)
+	copy(header[8:], "VP90")
+	binary.LittleEndian.PutUint16(header[12:], w.width)
+	binary.LittleEndian.PutUint16(header[14:], w.height)
+	binary.LittleEndian.PutUint32(header[16:], ivfTimeBase)
+	binary.LittleEndian.PutUint32(header[20:], 1)
+	binary.LittleEndian.PutUint32(header[24:], w.count)
+
+	return header
+}
+
+func (w *aVP9Writer) WriteRTP(packet *rtp.Packet) error {
+	if len(packet.Payload) == 0 {
+		return nil
+	}
+
+	var vp9 codecs.VP9Packet
+
+	_, err := vp9.Unmarshal(packet.Payload)
+
+	if err != nil {
+		return err
+	}
+
+	if vp9.V && vp9.Y && len(vp9.Width) > 0 && len(vp9.Height) > 0 {
+		w.width, w.height = vp9.Width[0], vp9.Height[0]
+	}
+
+	if vp9.B {
+		// the inter frames before the first key frame could not be decoded
+		if !w.hasKeyFrame && vp9.P {
+			return nil
+		}
+
+		w.hasKeyFrame = true
+		w.isInFrame = true
+		w.frame = w.frame[:0]
+	}
+
+	if !w.isInFrame {
+		return nil
+	}
+
+	w.frame = append(w.frame, vp9.Payload...)
+
+	if !vp9.E && !packet.Marker {
+		return nil
+	}
+
+	w.isInFrame = false
+
+	if w.count == 0 {
+		w.firstTimestamp = packet.Timestamp
+	}
+
+	frameHeader := make([]byte, 12)
+	binary.LittleEndian.PutUint32(frameHeader[0:], uint32(len(w.frame)))
+	binary.LittleEndian.PutUint64(frameHeader[4:], uint64(packet.Timestamp-w.firstTimestamp))
+
+	w.count++
+
+	_, err = w.file.Write(append(frameHeader, w.frame...))
+
+	return err
+}
+
+// Close updates the frame count and the resolution in the file header
+func (w *aVP9Writer) Close() error {
+	_, err := w.file.WriteAt(w.header(), 0)
+
+	if err != nil {
+		w.file.Close()
+		return err
+	}
+
+	return w.file.Close()
+}
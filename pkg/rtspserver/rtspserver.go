@@ -0,0 +1,462 @@
+// Package rtspserver serves a camera encoded by Bot Box over RTSP for NVRs and ground stations on the LAN,
+// RTP is sent over UDP or interleaved into the RTSP connection
+package rtspserver
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// sessionTimeout is announced to the clients, the connection is closed when nothing is received for twice as long
+	sessionTimeout = 60 * time.Second
+
+	publicMethods = "OPTIONS, DESCRIBE, SETUP, PLAY, TEARDOWN, GET_PARAMETER"
+)
+
+type Params struct {
+	// Address to listen on, e.g. ':8554', the server is disabled when empty
+	Address string
+	// Path of the stream, e.g. 'camera' for 'rtsp://robot:8554/camera'
+	Path     string
+	Username string
+	// Password enables basic authentication together with Username
+	Password string
+	// MaxViewers limits the number of simultaneous sessions, 0 - unlimited
+	MaxViewers int
+}
+
+func (p Params) Validate() error {
+	if p.Address == "" {
+		return nil
+	}
+
+	if strings.Trim(p.Path, "/") == "" {
+		return fmt.Errorf("RTSP path is not set")
+	}
+
+	if (p.Username == "") != (p.Password == "") {
+		return fmt.Errorf("both RTSP username and password should be set")
+	}
+
+	if p.MaxViewers < 0 {
+		return fmt.Errorf("RTSP max viewers should not be negative: %d", p.MaxViewers)
+	}
+
+	return nil
+}
+
+type aServer struct {
+	mu       sync.Mutex
+	params   Params
+	path     string
+	stream   *aStream
+	sessions int
+}
+
+// Serve starts the RTSP server, the source is encoded with the first of H264, VP8 and VP9 encoders available
+func Serve(source Source, p Params) error {
+	stream, ok := newStream(source)
+
+	if !ok {
+		return fmt.Errorf("no RTSP encoder is available, H264, VP8 or VP9 codec is required")
+	}
+
+	listener, err := net.Listen("tcp", p.Address)
+
+	if err != nil {
+		return err
+	}
+
+	s := &aServer{
+		params: p,
+		path:   strings.Trim(p.Path, "/"),
+		stream: stream,
+	}
+
+	log.Println("Serving RTSP on:", listener.Addr(), s.path, stream.mimeType)
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+
+			if err != nil {
+				log.Println("RTSP accept error", err)
+				return
+			}
+
+			go s.handleConnection(conn)
+		}
+	}()
+
+	return nil
+}
+
+func generateSessionID() string {
+	data := make([]byte, 8)
+	rand.Read(data)
+
+	return hex.EncodeToString(data)
+}
+
+func (s *aServer) isAuthorized(header textproto.MIMEHeader) bool {
+	if s.params.Username == "" {
+		return true
+	}
+
+	expected := "Basic " + base64.StdEncoding.EncodeToString([]byte(s.params.Username+":"+s.params.Password))
+
+	return subtle.ConstantTimeCompare([]byte(header.Get("Authorization")), []byte(expected)) == 1
+}
+
+// isStreamURL checks the path of the request URL, the control URLs of the track are relative to it
+func (s *aServer) isStreamURL(url string, suffix string) bool {
+	if i := strings.Index(url, "://"); i >= 0 {
+		url = url[i+3:]
+
+		if j := strings.Index(url, "/"); j >= 0 {
+			url = url[j:]
+		} else {
+			url = ""
+		}
+	}
+
+	if i := strings.Index(url, "?"); i >= 0 {
+		url = url[:i]
+	}
+
+	return strings.Trim(url, "/") == strings.Trim(s.path+"/"+suffix, "/")
+}
+
+func (s *aServer) acquireSession() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.params.MaxViewers > 0 && s.sessions >= s.params.MaxViewers {
+		return false
+	}
+
+	s.sessions++
+
+	return true
+}
+
+func (s *aServer) releaseSession() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sessions--
+}
+
+func (s *aServer) describe(host string) string {
+	lines := []string{
+		"v=0",
+		"o=- 0 0 IN IP4 " + host,
+		"s=Bot Box",
+		"c=IN IP4 0.0.0.0",
+		"t=0 0",
+		"m=video 0 RTP/AVP " + strconv.Itoa(payloadType),
+		fmt.Sprintf("a=rtpmap:%d %s/90000", payloadType, s.stream.encodingName()),
+	}
+
+	if s.stream.encodingName() == "H264" {
+		fmtp := fmt.Sprintf("a=fmtp:%d packetization-mode=1", payloadType)
+
+		if sps, pps := s.stream.parameterSets(); len(sps) >= 4 && pps != nil {
+			fmtp += fmt.Sprintf(";profile-level-id=%s;sprop-parameter-sets=%s,%s", hex.EncodeToString(sps[1:4]),
+				base64.StdEncoding.EncodeToString(sps), base64.StdEncoding.EncodeToString(pps))
+		}
+
+		lines = append(lines, fmtp)
+	}
+
+	lines = append(lines, "a=control:trackID=0", "")
+
+	return strings.Join(lines, "\r\n")
+}
+
+// aConnection is an RTSP connection with at most one session, as most of the clients keep the connection open
+type aConnection struct {
+	server    *aServer
+	conn      net.Conn
+	reader    *bufio.Reader
+	writeMux  sync.Mutex
+	sessionID string
+	transport *aTransport
+	viewer    *aViewer
+}
+
+type aResponse struct {
+	status  string
+	headers []string
+	body    string
+}
+
+func (c *aConnection) write(data []byte) error {
+	c.writeMux.Lock()
+	defer c.writeMux.Unlock()
+
+	c.conn.SetWriteDeadline(time.Now().Add(sessionTimeout))
+
+	_, err := c.conn.Write(data)
+
+	return err
+}
+
+func (c *aConnection) respond(cseq string, r aResponse) error {
+	var b strings.Builder
+
+	b.WriteString("RTSP/1.0 " + r.status + "\r\n")
+	b.WriteString("CSeq: " + cseq + "\r\n")
+	b.WriteString("Server: Bot Box\r\n")
+
+	for _, header := range r.headers {
+		b.WriteString(header + "\r\n")
+	}
+
+	if r.body != "" {
+		b.WriteString("Content-Length: " + strconv.Itoa(len(r.body)) + "\r\n")
+	}
+
+	b.WriteString("\r\n")
+	b.WriteString(r.body)
+
+	return c.write([]byte(b.String()))
+}
+
+// skipInterleaved drops RTCP reports the clients send into the connection
+func (c *aConnection) skipInterleaved() error {
+	header := make([]byte, 4)
+
+	_, err := io.ReadFull(c.reader, header)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = io.CopyN(ioutil.Discard, c.reader, int64(header[2])<<8|int64(header[3]))
+
+	return err
+}
+
+func (s *aServer) handleConnection(conn net.Conn) {
+	c := &aConnection{server: s, conn: conn, reader: bufio.NewReader(conn)}
+
+	defer conn.Close()
+	defer c.closeSession()
+
+	text := textproto.NewReader(c.reader)
+
+	for {
+		conn.SetReadDeadline(time.Now().Add(2 * sessionTimeout))
+
+		first, err := c.reader.Peek(1)
+
+		if err != nil {
+			return
+		}
+
+		if first[0] == '$' {
+			if c.skipInterleaved() != nil {
+				return
+			}
+
+			continue
+		}
+
+		line, err := text.ReadLine()
+
+		if err != nil {
+			return
+		}
+
+		header, err := text.ReadMIMEHeader()
+
+		if err != nil && err != io.EOF {
+			return
+		}
+
+		if length, _ := strconv.Atoi(header.Get("Content-Length")); length > 0 {
+			_, err = io.CopyN(ioutil.Discard, c.reader, int64(length))
+
+			if err != nil {
+				return
+			}
+		}
+
+		parts := strings.Fields(line)
+
+		if len(parts) != 3 || !strings.HasPrefix(parts[2], "RTSP/") {
+			log.Println("Malformed RTSP request:", line)
+			return
+		}
+
+		response := c.handleRequest(parts[0], parts[1], header)
+
+		if c.respond(header.Get("CSeq"), response) != nil {
+			return
+		}
+
+		if parts[0] == "TEARDOWN" {
+			return
+		}
+	}
+}
+
+func (c *aConnection) handleRequest(method string, url string, header textproto.MIMEHeader) aResponse {
+	if method == "OPTIONS" {
+		return aResponse{status: "200 OK", headers: []string{"Public: " + publicMethods}}
+	}
+
+	if !c.server.isAuthorized(header) {
+		return aResponse{status: "401 Unauthorized", headers: []string{`WWW-Authenticate: Basic realm="Bot Box"`}}
+	}
+
+	switch method {
+	case "DESCRIBE":
+		if !c.server.isStreamURL(url, "") {
+			return aResponse{status: "404 Not Found"}
+		}
+
+		host, _, _ := net.SplitHostPort(c.conn.LocalAddr().String())
+
+		return aResponse{
+			status: "200 OK",
+			headers: []string{
+				"Content-Type: application/sdp",
+				"Content-Base: " + strings.TrimSuffix(url, "/") + "/",
+			},
+			body: c.server.describe(host),
+		}
+
+	case "SETUP":
+		return c.setup(url, header)
+
+	case "PLAY":
+		return c.play(header)
+
+	case "TEARDOWN":
+		c.closeSession()
+		return aResponse{status: "200 OK"}
+
+	case "GET_PARAMETER":
+		return aResponse{status: "200 OK"}
+	}
+
+	return aResponse{status: "405 Method Not Allowed", headers: []string{"Allow: " + publicMethods}}
+}
+
+func (c *aConnection) sessionHeader() string {
+	return fmt.Sprintf("Session: %s;timeout=%d", c.sessionID, int(sessionTimeout.Seconds()))
+}
+
+func (c *aConnection) setup(url string, header textproto.MIMEHeader) aResponse {
+	if !c.server.isStreamURL(url, "trackID=0") && !c.server.isStreamURL(url, "") {
+		return aResponse{status: "404 Not Found"}
+	}
+
+	if c.sessionID != "" {
+		return aResponse{status: "459 Aggregate Operation Not Allowed"}
+	}
+
+	transport, err := parseTransport(header.Get("Transport"))
+
+	if err != nil {
+		log.Println("RTSP setup error", err)
+		return aResponse{status: "461 Unsupported Transport"}
+	}
+
+	if !c.server.acquireSession() {
+		log.Println("RTSP session rejected, too many viewers:", c.conn.RemoteAddr())
+		transport.close()
+		return aResponse{status: "453 Not Enough Bandwidth"}
+	}
+
+	if !transport.isInterleaved {
+		err = transport.dial(c.conn.RemoteAddr())
+
+		if err != nil {
+			log.Println("RTSP setup error", err)
+			c.server.releaseSession()
+			return aResponse{status: "500 Internal Server Error"}
+		}
+	}
+
+	c.sessionID = generateSessionID()
+	c.transport = transport
+
+	log.Println("RTSP session created:", c.sessionID, c.conn.RemoteAddr(), transport.describe())
+
+	return aResponse{status: "200 OK", headers: []string{"Transport: " + transport.describe(), c.sessionHeader()}}
+}
+
+func (c *aConnection) play(header textproto.MIMEHeader) aResponse {
+	if c.sessionID == "" || !strings.HasPrefix(header.Get("Session"), c.sessionID) {
+		return aResponse{status: "454 Session Not Found"}
+	}
+
+	if c.viewer == nil {
+		write := c.transport.write
+
+		if c.transport.isInterleaved {
+			channel := c.transport.channel
+
+			write = func(packet []byte) error {
+				frame := make([]byte, 4+len(packet))
+				frame[0] = '$'
+				frame[1] = channel
+				frame[2] = byte(len(packet) >> 8)
+				frame[3] = byte(len(packet))
+				copy(frame[4:], packet)
+
+				return c.write(frame)
+			}
+		}
+
+		viewer := newViewer(write)
+
+		err := c.server.stream.add(viewer)
+
+		if err != nil {
+			log.Println("RTSP play error", err)
+			close(viewer.queue)
+			return aResponse{status: "500 Internal Server Error"}
+		}
+
+		c.viewer = viewer
+	}
+
+	return aResponse{status: "200 OK", headers: []string{c.sessionHeader(), "Range: npt=0.000-"}}
+}
+
+func (c *aConnection) closeSession() {
+	if c.sessionID == "" {
+		return
+	}
+
+	if c.viewer != nil {
+		c.server.stream.remove(c.viewer)
+		c.viewer = nil
+	}
+
+	c.transport.close()
+	c.server.releaseSession()
+
+	log.Println("RTSP session closed:", c.sessionID)
+
+	c.sessionID = ""
+	c.transport = nil
+}
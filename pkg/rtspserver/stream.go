@@ -0,0 +1,308 @@
+package rtspserver
+
+import (
+	"encoding/binary"
+	"log"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pion/mediadevices"
+	"github.com/pion/mediadevices/pkg/codec"
+	"github.com/pion/webrtc/v3"
+)
+
+const (
+	// payloadType is announced in SDP, the packets of the encoder are rewritten to it
+	payloadType = 96
+
+	mtu = 1200
+
+	// viewerQueueSize of packets, a slow viewer drops packets instead of holding back the others
+	viewerQueueSize = 512
+
+	// probeTimeout limits waiting for the first H264 key frame with the parameter sets on start
+	probeTimeout = 3 * time.Second
+
+	naluTypeSPS   = 7
+	naluTypePPS   = 8
+	naluTypeSTAPA = 24
+)
+
+// mimeTypes in the order of preference, most of NVRs support H264 only
+var mimeTypes = []string{webrtc.MimeTypeH264, webrtc.MimeTypeVP8, webrtc.MimeTypeVP9}
+
+// Source is a track encoded by Bot Box, e.g. mediadevices.Track, so the camera is not opened twice.
+// mediadevices has no shared encoder to tap: every reader of the track gets its own encoder of the shared camera
+// frames, the WebRTC sessions including. Their RTP could not be reused either, as it exists only while an operator
+// is connected and follows the codec and the bit rate negotiated by that operator.
+type Source interface {
+	NewRTPReader(codecName string, ssrc uint32, mtu int) (mediadevices.RTPReadCloser, error)
+}
+
+type aViewer struct {
+	queue      chan []byte
+	write      func([]byte) error
+	isDropping bool
+}
+
+func newViewer(write func([]byte) error) *aViewer {
+	v := &aViewer{queue: make(chan []byte, viewerQueueSize), write: write}
+
+	go func() {
+		isFailed := false
+
+		for packet := range v.queue {
+			if isFailed {
+				continue
+			}
+
+			err := v.write(packet)
+
+			// the session is closed by the connection, the rest of the queue is dropped
+			if err != nil {
+				log.Println("RTSP write error", err)
+				isFailed = true
+			}
+		}
+	}()
+
+	return v
+}
+
+// aStream encodes the source once for all the viewers, the encoder is running only while somebody is watching
+type aStream struct {
+	mu       sync.Mutex
+	source   Source
+	mimeType string
+	ssrc     uint32
+	viewers  map[*aViewer]struct{}
+	reader   mediadevices.RTPReadCloser
+	// sps and pps are the latest H264 parameter sets for 'sprop-parameter-sets'
+	sps []byte
+	pps []byte
+}
+
+// newStream picks the first codec the source could be encoded with
+func newStream(source Source) (*aStream, bool) {
+	s := &aStream{
+		source:  source,
+		ssrc:    rand.Uint32(),
+		viewers: make(map[*aViewer]struct{}),
+	}
+
+	for _, mimeType := range mimeTypes {
+		reader, err := source.NewRTPReader(mimeType, s.ssrc, mtu)
+
+		if err != nil {
+			continue
+		}
+
+		s.mimeType = mimeType
+
+		if mimeType == webrtc.MimeTypeH264 {
+			s.probeParameterSets(reader)
+		}
+
+		reader.Close()
+
+		return s, true
+	}
+
+	return nil, false
+}
+
+// probeParameterSets reads the first key frame, so the players could start decoding without waiting for the in-band
+// parameter sets
+func (s *aStream) probeParameterSets(reader mediadevices.RTPReadCloser) {
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+
+		for {
+			packets, release, err := reader.Read()
+
+			if err != nil {
+				return
+			}
+
+			for _, packet := range packets {
+				s.collectParameterSets(packet.Payload)
+			}
+
+			release()
+
+			if sps, pps := s.parameterSets(); sps != nil && pps != nil {
+				return
+			}
+		}
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(probeTimeout):
+		log.Println("RTSP H264 parameter sets are not received, they are sent in-band only")
+	}
+}
+
+// collectParameterSets keeps SPS and PPS of the single NAL unit and STAP-A packets
+func (s *aStream) collectParameterSets(payload []byte) {
+	if len(payload) == 0 {
+		return
+	}
+
+	units := [][]byte{payload}
+
+	if payload[0]&0x1f == naluTypeSTAPA {
+		units = units[:0]
+
+		for rest := payload[1:]; len(rest) > 2; {
+			size := int(binary.BigEndian.Uint16(rest))
+			rest = rest[2:]
+
+			if size > len(rest) {
+				break
+			}
+
+			units = append(units, rest[:size])
+			rest = rest[size:]
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, unit := range units {
+		if len(unit) == 0 {
+			continue
+		}
+
+		switch unit[0] & 0x1f {
+		case naluTypeSPS:
+			s.sps = append([]byte(nil), unit...)
+		case naluTypePPS:
+			s.pps = append([]byte(nil), unit...)
+		}
+	}
+}
+
+func (s *aStream) parameterSets() ([]byte, []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.sps, s.pps
+}
+
+// encodingName of the codec in SDP, e.g. 'H264'
+func (s *aStream) encodingName() string {
+	return strings.TrimPrefix(s.mimeType, "video/")
+}
+
+func (s *aStream) add(v *aViewer) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.viewers[v] = struct{}{}
+
+	if s.reader != nil {
+		// the new viewer could not decode anything until the next key frame
+		if c, ok := s.reader.Controller().(codec.KeyFrameController); ok {
+			c.ForceKeyFrame()
+		}
+
+		return nil
+	}
+
+	reader, err := s.source.NewRTPReader(s.mimeType, s.ssrc, mtu)
+
+	if err != nil {
+		delete(s.viewers, v)
+		return err
+	}
+
+	log.Println("RTSP encoder started:", s.mimeType)
+
+	s.reader = reader
+
+	go s.run(reader)
+
+	return nil
+}
+
+func (s *aStream) remove(v *aViewer) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, ok := s.viewers[v]
+
+	if !ok {
+		return
+	}
+
+	delete(s.viewers, v)
+	close(v.queue)
+
+	if len(s.viewers) == 0 && s.reader != nil {
+		log.Println("RTSP encoder stopped, no viewers left")
+
+		s.reader.Close()
+		s.reader = nil
+	}
+}
+
+func (s *aStream) broadcast(packet []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for v := range s.viewers {
+		select {
+		case v.queue <- packet:
+			v.isDropping = false
+		default:
+			if !v.isDropping {
+				log.Println("RTSP viewer could not keep up, dropping packets")
+				v.isDropping = true
+			}
+		}
+	}
+}
+
+func (s *aStream) run(reader mediadevices.RTPReadCloser) {
+	for {
+		packets, release, err := reader.Read()
+
+		if err != nil {
+			s.mu.Lock()
+			defer s.mu.Unlock()
+
+			// the encoder is started again for the next viewer
+			if s.reader == reader {
+				log.Println("RTSP encoder error", err)
+				s.reader = nil
+			}
+
+			return
+		}
+
+		for _, packet := range packets {
+			if s.mimeType == webrtc.MimeTypeH264 {
+				s.collectParameterSets(packet.Payload)
+			}
+
+			packet.PayloadType = payloadType
+
+			data, err := packet.Marshal()
+
+			if err != nil {
+				log.Println("Serialize RTP packet error", err)
+				continue
+			}
+
+			s.broadcast(data)
+		}
+
+		release()
+	}
+}
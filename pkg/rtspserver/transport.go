@@ -0,0 +1,152 @@
+package rtspserver
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// aTransport of a session, RTP is interleaved into the RTSP connection or sent to the client UDP port
+type aTransport struct {
+	isInterleaved bool
+	channel       byte
+	clientPorts   [2]int
+	rtpConn       *net.UDPConn
+	rtcpConn      *net.UDPConn
+	clientAddr    *net.UDPAddr
+}
+
+func parsePorts(value string) ([2]int, error) {
+	var ports [2]int
+
+	parts := strings.SplitN(value, "-", 2)
+
+	for i, part := range parts {
+		port, err := strconv.Atoi(part)
+
+		if err != nil || port < 0 || port > 65535 {
+			return ports, fmt.Errorf("malformed ports: %s", value)
+		}
+
+		ports[i] = port
+	}
+
+	if len(parts) == 1 {
+		ports[1] = ports[0] + 1
+	}
+
+	return ports, nil
+}
+
+// parseTransport picks the first supported of the transports offered by the client,
+// e.g. 'RTP/AVP/TCP;unicast;interleaved=0-1' or 'RTP/AVP;unicast;client_port=5000-5001'
+func parseTransport(header string) (*aTransport, error) {
+	for _, option := range strings.Split(header, ",") {
+		fields := strings.Split(strings.TrimSpace(option), ";")
+		profile := strings.ToUpper(fields[0])
+
+		t := &aTransport{isInterleaved: profile == "RTP/AVP/TCP"}
+
+		if profile != "RTP/AVP" && profile != "RTP/AVP/UDP" && !t.isInterleaved {
+			continue
+		}
+
+		isSupported := true
+		hasPorts := false
+
+		for _, field := range fields[1:] {
+			key := field
+			value := ""
+
+			if i := strings.Index(field, "="); i >= 0 {
+				key = field[:i]
+				value = field[i+1:]
+			}
+
+			switch strings.ToLower(key) {
+			case "multicast":
+				isSupported = false
+
+			case "interleaved":
+				channels, err := parsePorts(value)
+
+				if err != nil || channels[0] > 255 {
+					return nil, fmt.Errorf("malformed interleaved channels: %s", value)
+				}
+
+				t.channel = byte(channels[0])
+
+			case "client_port":
+				ports, err := parsePorts(value)
+
+				if err != nil {
+					return nil, err
+				}
+
+				t.clientPorts = ports
+				hasPorts = true
+			}
+		}
+
+		if !isSupported || (!t.isInterleaved && !hasPorts) {
+			continue
+		}
+
+		return t, nil
+	}
+
+	return nil, fmt.Errorf("unsupported transport: %s", header)
+}
+
+// dial opens the server ports to send RTP to the client, RTCP port is only announced
+func (t *aTransport) dial(remote net.Addr) error {
+	host, _, err := net.SplitHostPort(remote.String())
+
+	if err != nil {
+		return err
+	}
+
+	t.clientAddr = &net.UDPAddr{IP: net.ParseIP(host), Port: t.clientPorts[0]}
+
+	t.rtpConn, err = net.ListenUDP("udp", &net.UDPAddr{})
+
+	if err != nil {
+		return err
+	}
+
+	t.rtcpConn, err = net.ListenUDP("udp", &net.UDPAddr{})
+
+	if err != nil {
+		t.rtpConn.Close()
+		return err
+	}
+
+	return nil
+}
+
+func (t *aTransport) write(packet []byte) error {
+	_, err := t.rtpConn.WriteToUDP(packet, t.clientAddr)
+
+	return err
+}
+
+func (t *aTransport) describe() string {
+	if t.isInterleaved {
+		return fmt.Sprintf("RTP/AVP/TCP;unicast;interleaved=%d-%d", t.channel, int(t.channel)+1)
+	}
+
+	return fmt.Sprintf("RTP/AVP;unicast;client_port=%d-%d;server_port=%d-%d",
+		t.clientPorts[0], t.clientPorts[1],
+		t.rtpConn.LocalAddr().(*net.UDPAddr).Port, t.rtcpConn.LocalAddr().(*net.UDPAddr).Port)
+}
+
+func (t *aTransport) close() {
+	if t.rtpConn != nil {
+		t.rtpConn.Close()
+	}
+
+	if t.rtcpConn != nil {
+		t.rtcpConn.Close()
+	}
+}
@@ -0,0 +1,142 @@
+// Package snapshot captures full resolution still images from the raw video frames
+package snapshot
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/pion/mediadevices/pkg/io/video"
+)
+
+const (
+	FormatJPEG = "jpeg"
+	FormatPNG  = "png"
+
+	captureTimeout = 5 * time.Second
+)
+
+type Config struct {
+	// Format is jpeg or png
+	Format string
+	// Quality of JPEG encoding, 1-100
+	Quality int
+	// Directory to keep a copy of every snapshot with the metadata sidecar, not saved when empty
+	Directory string
+}
+
+// Source is a video track with access to the raw frames, e.g. mediadevices.VideoTrack
+type Source interface {
+	NewReader(copyFrame bool) video.Reader
+}
+
+// Metadata is saved next to the image as a JSON sidecar
+type Metadata struct {
+	Time      time.Time       `json:"time"`
+	BotID     int             `json:"botId"`
+	Camera    string          `json:"camera"`
+	Format    string          `json:"format"`
+	Width     int             `json:"width"`
+	Height    int             `json:"height"`
+	Telemetry json.RawMessage `json:"telemetry,omitempty"`
+}
+
+func IsValidFormat(format string) bool {
+	return format == FormatJPEG || format == FormatPNG
+}
+
+func (c Config) Validate() error {
+	if !IsValidFormat(c.Format) {
+		return fmt.Errorf("unknown snapshot format: %s", c.Format)
+	}
+
+	if c.Quality < 1 || c.Quality > 100 {
+		return fmt.Errorf("snapshot quality should be in 1-100 range: %d", c.Quality)
+	}
+
+	return nil
+}
+
+// Capture reads the next frame of the source, the frame is copied so it is not affected by the encoders
+func Capture(source Source) (image.Image, error) {
+	type aResult struct {
+		img image.Image
+		err error
+	}
+
+	resultChan := make(chan aResult, 1)
+
+	go func() {
+		img, release, err := source.NewReader(true).Read()
+
+		if err == nil {
+			release()
+		}
+
+		resultChan <- aResult{img: img, err: err}
+	}()
+
+	select {
+	case result := <-resultChan:
+		return result.img, result.err
+	case <-time.After(captureTimeout):
+		return nil, fmt.Errorf("no frame received in %s", captureTimeout)
+	}
+}
+
+func Encode(img image.Image, format string, quality int) ([]byte, error) {
+	var buf bytes.Buffer
+	var err error
+
+	switch format {
+	case FormatJPEG:
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality})
+	case FormatPNG:
+		err = png.Encode(&buf, img)
+	default:
+		err = fmt.Errorf("unknown snapshot format: %s", format)
+	}
+
+	return buf.Bytes(), err
+}
+
+// Save writes the image and its metadata sidecar to the directory, the file name is returned
+func Save(directory string, data []byte, m Metadata) (string, error) {
+	err := os.MkdirAll(directory, 0755)
+
+	if err != nil {
+		return "", err
+	}
+
+	extension := "jpg"
+
+	if m.Format == FormatPNG {
+		extension = "png"
+	}
+
+	base := fmt.Sprintf("%s_%d_%s", m.Time.Format("20060102-150405.000"), m.BotID, m.Camera)
+	name := filepath.Join(directory, base+"."+extension)
+
+	err = ioutil.WriteFile(name, data, 0644)
+
+	if err != nil {
+		return "", err
+	}
+
+	sidecar, err := json.MarshalIndent(m, "", "  ")
+
+	if err != nil {
+		return "", err
+	}
+
+	err = ioutil.WriteFile(filepath.Join(directory, base+".json"), sidecar, 0644)
+
+	return name, err
+}
@@ -0,0 +1,218 @@
+package standalone
+
+// controlPage connects to a bot peer-to-peer: it shows the video, sends W A S D and arrow keys as 'CONTROLS'
+// and prints the latest data channel messages of every type
+const controlPage = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>Bot Box</title>
+<style>
+  body { margin: 0; font-family: sans-serif; background: #111; color: #eee; }
+  #bar { display: flex; flex-wrap: wrap; gap: 8px; align-items: center; padding: 8px; background: #222; }
+  #video { display: block; width: 100%; max-height: 75vh; background: #000; }
+  #messages { margin: 8px; font-size: 12px; white-space: pre-wrap; }
+</style>
+</head>
+<body>
+<div id="bar">
+  <select id="bot"></select>
+  <input id="token" placeholder="Operator token (optional)">
+  <button id="connect" disabled>Connect</button>
+  <button id="disconnect" disabled>Disconnect</button>
+  <span id="status">Connecting to Bot Box...</span>
+</div>
+<video id="video" autoplay playsinline muted></video>
+<audio id="audio" autoplay></audio>
+<div id="messages">Drive with W A S D or arrow keys.</div>
+<script>
+  const $ = (id) => document.getElementById(id);
+  const key = new URLSearchParams(location.search).get('key') || '';
+  const ws = new WebSocket('wss://' + location.host + '/ws?key=' + encodeURIComponent(key));
+  const keys = { KeyW: 'f', ArrowUp: 'f', KeyS: 'b', ArrowDown: 'b', KeyA: 'l', ArrowLeft: 'l', KeyD: 'r', ArrowRight: 'r' };
+  const controls = { f: 0, b: 0, l: 0, r: 0 };
+  const messages = {};
+
+  let pc = null;
+  let channel = null;
+  let unreliableChannel = null;
+  let controlsSeq = 0;
+  let botId = 0;
+  let pendingCandidates = [];
+  let queue = Promise.resolve();
+
+  const setStatus = (text) => { $('status').textContent = text; };
+  const send = (action, id, data) => ws.send(JSON.stringify({ action: action, id: id, data: data }));
+
+  // connecting again is allowed once the bot is released, e.g. after 'UNBLOCK_DISCONNECTED'
+  function close(reason, isReleased) {
+    if (channel && channel.readyState === 'open') {
+      channel.send(JSON.stringify({ type: 'NOT_READY' }));
+    }
+
+    if (pc) {
+      pc.close();
+    }
+
+    pc = null;
+    channel = null;
+    unreliableChannel = null;
+    pendingCandidates = [];
+    $('video').srcObject = null;
+    $('connect').disabled = !isReleased;
+    $('disconnect').disabled = true;
+    setStatus(reason);
+  }
+
+  async function connect() {
+    botId = Number($('bot').value);
+    pc = new RTCPeerConnection();
+
+    pc.addTransceiver('video', { direction: 'recvonly' });
+    pc.addTransceiver('audio', { direction: 'recvonly' });
+
+    pc.ontrack = (event) => {
+      const element = event.track.kind === 'video' ? $('video') : $('audio');
+      element.srcObject = new MediaStream([event.track]);
+    };
+
+    pc.onicecandidate = (event) => {
+      if (event.candidate) {
+        send('SET_CANDIDATE', botId, event.candidate.toJSON());
+      }
+    };
+
+    pc.onconnectionstatechange = () => {
+      if (pc) {
+        setStatus('WebRTC ' + pc.connectionState);
+      }
+    };
+
+    channel = pc.createDataChannel('controls');
+    channel.onopen = () => channel.send(JSON.stringify({ type: 'READY' }));
+    channel.onmessage = showMessage;
+
+    // the controls and the telemetry go without retransmits, a lost packet does not hold back the next ones
+    unreliableChannel = pc.createDataChannel('unreliable', { ordered: false, maxRetransmits: 0 });
+    unreliableChannel.onmessage = showMessage;
+
+    $('connect').disabled = true;
+    $('disconnect').disabled = false;
+
+    await pc.setLocalDescription(await pc.createOffer());
+
+    const description = pc.localDescription.toJSON();
+    description.operatorToken = $('token').value;
+
+    send('SET_DESCRIPTION', botId, description);
+    setStatus('Connecting to bot...');
+  }
+
+  async function setRemoteDescription(description) {
+    await pc.setRemoteDescription(description);
+
+    // the bot offers ICE restart after a network change
+    if (description.type === 'offer') {
+      await pc.setLocalDescription(await pc.createAnswer());
+      send('SET_DESCRIPTION', botId, pc.localDescription.toJSON());
+    }
+
+    for (const candidate of pendingCandidates) {
+      await pc.addIceCandidate(candidate);
+    }
+
+    pendingCandidates = [];
+  }
+
+  async function handle(message) {
+    const payload = message.payload;
+
+    if (message.name === 'ARENA') {
+      for (let i = 0; i < payload.bots; i++) {
+        const option = document.createElement('option');
+        option.value = i;
+        option.textContent = 'Bot ' + i;
+        $('bot').appendChild(option);
+      }
+
+      send('IS_BOT_READY_FOR_CONNECTION', 0, null);
+      return;
+    }
+
+    if (message.name === 'BOT_IS_READY_FOR_CONNECTION') {
+      if (!pc && payload.id === Number($('bot').value)) {
+        $('connect').disabled = !payload.isReady;
+        setStatus(payload.isReady ? 'Bot is ready' : 'Bot is busy');
+      }
+
+      return;
+    }
+
+    if (!pc || payload.id !== botId) {
+      return;
+    }
+
+    switch (message.name) {
+      case 'SET_DESCRIPTION':
+        await setRemoteDescription(payload.description);
+        break;
+
+      case 'SET_CANDIDATE':
+        if (pc.remoteDescription) {
+          await pc.addIceCandidate(payload.candidate);
+        } else {
+          pendingCandidates.push(payload.candidate);
+        }
+        break;
+
+      case 'BOT_CONNECTED':
+        setStatus('Connected to bot ' + botId);
+        break;
+
+      case 'UNBLOCK_DISCONNECTED':
+        close('Disconnected', true);
+        break;
+    }
+  }
+
+  function showMessage(event) {
+    const message = JSON.parse(event.data);
+    messages[message.type] = event.data;
+    $('messages').textContent = Object.values(messages).join('\n');
+  }
+
+  function sendControls(event, value) {
+    const control = keys[event.code];
+
+    if (!control || !channel || channel.readyState !== 'open' || controls[control] === value) {
+      return;
+    }
+
+    event.preventDefault();
+    controls[control] = value;
+
+    const target = unreliableChannel && unreliableChannel.readyState === 'open' ? unreliableChannel : channel;
+    controlsSeq++;
+    target.send(JSON.stringify({ type: 'CONTROLS', payload: JSON.stringify(controls), seq: controlsSeq }));
+  }
+
+  ws.onopen = () => setStatus('Connected to Bot Box');
+  ws.onclose = () => close('Bot Box connection lost, reload the page', false);
+  ws.onmessage = (event) => {
+    queue = queue.then(() => handle(JSON.parse(event.data))).catch((error) => setStatus(error.message));
+  };
+
+  $('bot').onchange = () => send('IS_BOT_READY_FOR_CONNECTION', Number($('bot').value), null);
+  $('connect').onclick = () => connect().catch((error) => close(error.message, true));
+  $('disconnect').onclick = () => {
+    send('DISCONNECT_BOT', botId, null);
+    close('Disconnecting...', false);
+  };
+
+  document.addEventListener('keydown', (event) => sendControls(event, 100));
+  document.addEventListener('keyup', (event) => sendControls(event, 0));
+</script>
+</body>
+</html>
+`
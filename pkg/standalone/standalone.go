@@ -0,0 +1,389 @@
+// Package standalone replaces RoboPortal on a network without internet access: it serves a WebSocket signaling
+// endpoint for the browsers on the same network and speaks the platform actions to the arena
+package standalone
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"crypto/tls"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// clientQueueSize of messages to a browser, the messages are dropped when it could not keep up
+	clientQueueSize = 100
+
+	connected = "connected"
+)
+
+// browserActions are the platform actions the browsers are allowed to send, supervisor actions are not exposed
+var browserActions = map[string]bool{
+	"IS_BOT_READY_FOR_CONNECTION": true,
+	"SET_DESCRIPTION":             true,
+	"SET_CANDIDATE":               true,
+	"DISCONNECT_BOT":              true,
+}
+
+type InitParams struct {
+	// Address to listen on, e.g. ':8443'
+	Address string
+	// CertFile and KeyFile of the TLS certificate, a self-signed certificate is generated when empty
+	CertFile string
+	KeyFile  string
+	// AccessKey is required from the browsers as 'key' query parameter when set
+	AccessKey          string
+	BotsCount          int
+	AreControlsAllowed bool
+
+	// ReceiveChan, SendChan and ConStatChan are the arena channels otherwise served by the communicator
+	ReceiveChan chan string
+	SendChan    chan string
+	ConStatChan chan string
+}
+
+func (p InitParams) Validate() error {
+	if p.Address == "" {
+		return fmt.Errorf("standalone address is not set")
+	}
+
+	if (p.CertFile == "") != (p.KeyFile == "") {
+		return fmt.Errorf("both standalone certificate and key files should be set")
+	}
+
+	if p.BotsCount < 1 {
+		return fmt.Errorf("standalone bots count should be positive: %d", p.BotsCount)
+	}
+
+	return nil
+}
+
+type aClient struct {
+	id   string
+	send chan []byte
+}
+
+type aServer struct {
+	mu       sync.Mutex
+	params   InitParams
+	upgrader websocket.Upgrader
+	clients  map[string]*aClient
+	// owners are the clients which started the sessions of the bots
+	owners map[int]string
+}
+
+func generateID() string {
+	data := make([]byte, 8)
+	rand.Read(data)
+
+	return hex.EncodeToString(data)
+}
+
+// Init configures the arena and serves the control page and the signaling endpoint
+func Init(p InitParams) {
+	err := p.Validate()
+
+	if err != nil {
+		panic(err)
+	}
+
+	s := &aServer{
+		params:  p,
+		clients: make(map[string]*aClient),
+		owners:  make(map[int]string),
+	}
+
+	s.configureArena()
+
+	go s.forwardArenaMessages()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", s.handlePage)
+	mux.HandleFunc("/ws", s.handleWebSocket)
+
+	server := &http.Server{Addr: p.Address, Handler: mux}
+
+	if p.CertFile == "" {
+		certificate, err := generateCertificate()
+
+		if err != nil {
+			panic(err)
+		}
+
+		server.TLSConfig = &tls.Config{Certificates: []tls.Certificate{certificate}}
+	}
+
+	log.Println("Serving standalone control page on:", "https://"+p.Address)
+
+	err = server.ListenAndServeTLS(p.CertFile, p.KeyFile)
+
+	log.Println("Standalone server error", err)
+	panic(err)
+}
+
+// configureArena stands in for the platform connection and 'ARENA_CONFIG' action
+func (s *aServer) configureArena() {
+	type aConfig struct {
+		AreControlsAllowed       bool
+		CameraMultiplexerEnabled bool
+		NBots                    int
+	}
+
+	config, _ := json.Marshal(aConfig{AreControlsAllowed: s.params.AreControlsAllowed, NBots: s.params.BotsCount})
+
+	s.params.ConStatChan <- connected
+	s.sendToArena("ARENA_CONFIG", "", string(config), 0)
+}
+
+func (s *aServer) sendToArena(action string, connectionID string, data string, id int) {
+	type anAction struct {
+		Action       string
+		ConnectionID string
+		Data         string
+		ID           int
+	}
+
+	message, _ := json.Marshal(anAction{Action: action, ConnectionID: connectionID, Data: data, ID: id})
+
+	s.params.ReceiveChan <- string(message)
+}
+
+func (s *aServer) sendToClient(clientID string, message []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	client, ok := s.clients[clientID]
+
+	if !ok {
+		return
+	}
+
+	select {
+	case client.send <- message:
+	default:
+		log.Println("Standalone client could not keep up, dropping message:", clientID)
+	}
+}
+
+func (s *aServer) broadcast(message []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, client := range s.clients {
+		select {
+		case client.send <- message:
+		default:
+		}
+	}
+}
+
+// forwardArenaMessages routes the actions of the bots to the browsers, the platform credentials are stripped
+func (s *aServer) forwardArenaMessages() {
+	for msg := range s.params.SendChan {
+		type anAction struct {
+			Name    string                     `json:"name"`
+			Payload map[string]json.RawMessage `json:"payload"`
+		}
+
+		var action anAction
+
+		err := json.Unmarshal([]byte(msg), &action)
+
+		if err != nil {
+			log.Println("Parse message from arena error", err)
+			continue
+		}
+
+		var id int
+		json.Unmarshal(action.Payload["id"], &id)
+
+		delete(action.Payload, "token")
+		delete(action.Payload, "publicKey")
+
+		message, err := json.Marshal(action)
+
+		if err != nil {
+			log.Println("Serialize message to browser error", err)
+			continue
+		}
+
+		switch action.Name {
+		case "BOT_IS_READY_FOR_CONNECTION", "CREATE_CONNECTION":
+			s.broadcast(message)
+
+		case "SET_DESCRIPTION", "SET_CANDIDATE", "BOT_CONNECTED":
+			s.mu.Lock()
+			owner := s.owners[id]
+			s.mu.Unlock()
+
+			s.sendToClient(owner, message)
+
+		case "UNBLOCK_DISCONNECTED":
+			s.mu.Lock()
+			owner := s.owners[id]
+			delete(s.owners, id)
+			s.mu.Unlock()
+
+			s.sendToClient(owner, message)
+
+			// the readiness reported by the arena is broadcast, the bot could be busy again or not ready.
+			// The forwarding is not held back by the arena, which could be writing to this loop
+			go s.sendToArena("IS_BOT_READY_FOR_CONNECTION", "", "", id)
+
+		default:
+			log.Println("Action is not supported in standalone mode:", action.Name)
+		}
+	}
+}
+
+func (s *aServer) handlePage(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write([]byte(controlPage))
+}
+
+func (s *aServer) isAuthorized(r *http.Request) bool {
+	if s.params.AccessKey == "" {
+		return true
+	}
+
+	return subtle.ConstantTimeCompare([]byte(r.URL.Query().Get("key")), []byte(s.params.AccessKey)) == 1
+}
+
+func (s *aServer) handleWebSocket(w http.ResponseWriter, r *http.Request) {
+	if !s.isAuthorized(r) {
+		http.Error(w, "wrong access key", http.StatusUnauthorized)
+		return
+	}
+
+	conn, err := s.upgrader.Upgrade(w, r, nil)
+
+	if err != nil {
+		log.Println("Standalone WebSocket upgrade error", err)
+		return
+	}
+
+	client := &aClient{id: generateID(), send: make(chan []byte, clientQueueSize)}
+
+	s.mu.Lock()
+	s.clients[client.id] = client
+	s.mu.Unlock()
+
+	log.Println("Standalone client connected:", client.id, r.RemoteAddr)
+
+	done := make(chan struct{})
+
+	go func() {
+		defer conn.Close()
+
+		for {
+			select {
+			case message := <-client.send:
+				err := conn.WriteMessage(websocket.TextMessage, message)
+
+				if err != nil {
+					return
+				}
+
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	client.send <- []byte(fmt.Sprintf("{\"name\": \"ARENA\", \"payload\": {\"bots\": %d}}", s.params.BotsCount))
+
+	for {
+		_, message, err := conn.ReadMessage()
+
+		if err != nil {
+			break
+		}
+
+		s.handleClientMessage(client, message)
+	}
+
+	close(done)
+	s.removeClient(client)
+}
+
+// handleClientMessage passes the action to the arena on behalf of the browser,
+// the message is '{"action": "SET_DESCRIPTION", "id": 0, "data": {...}}'
+func (s *aServer) handleClientMessage(client *aClient, message []byte) {
+	type aMessage struct {
+		Action string          `json:"action"`
+		ID     int             `json:"id"`
+		Data   json.RawMessage `json:"data"`
+	}
+
+	var data aMessage
+
+	err := json.Unmarshal(message, &data)
+
+	if err != nil || !browserActions[data.Action] || data.ID < 0 || data.ID >= s.params.BotsCount {
+		log.Println("Unexpected message from standalone client:", client.id, string(message))
+		return
+	}
+
+	if data.Action == "SET_DESCRIPTION" {
+		s.mu.Lock()
+		owner, ok := s.owners[data.ID]
+
+		if !ok {
+			s.owners[data.ID] = client.id
+		}
+		s.mu.Unlock()
+
+		if ok && owner != client.id {
+			log.Println("Bot is busy with another standalone client:", data.ID)
+			s.sendToClient(client.id, []byte(fmt.Sprintf("{\"name\": \"BOT_IS_READY_FOR_CONNECTION\", \"payload\": {\"id\": %d, \"isReady\": false}}", data.ID)))
+			return
+		}
+	}
+
+	// only the client which started the session could trickle its candidates or end it
+	if data.Action == "SET_CANDIDATE" || data.Action == "DISCONNECT_BOT" {
+		s.mu.Lock()
+		owner := s.owners[data.ID]
+		s.mu.Unlock()
+
+		if owner != client.id {
+			log.Println("Bot session is not owned by standalone client:", data.ID, client.id, data.Action)
+			return
+		}
+	}
+
+	s.sendToArena(data.Action, client.id, string(data.Data), data.ID)
+}
+
+// removeClient closes the sessions started by the browser
+func (s *aServer) removeClient(client *aClient) {
+	s.mu.Lock()
+	delete(s.clients, client.id)
+
+	bots := make([]int, 0)
+
+	for id, owner := range s.owners {
+		if owner == client.id {
+			bots = append(bots, id)
+			delete(s.owners, id)
+		}
+	}
+	s.mu.Unlock()
+
+	log.Println("Standalone client disconnected:", client.id)
+
+	for _, id := range bots {
+		s.sendToArena("DISCONNECT_BOT", client.id, "", id)
+	}
+}
@@ -0,0 +1,82 @@
+package synthetic
+
+import (
+	"io"
+	"math"
+	"time"
+
+	"github.com/pion/mediadevices/pkg/io/audio"
+	"github.com/pion/mediadevices/pkg/prop"
+	"github.com/pion/mediadevices/pkg/wave"
+)
+
+const toneAmplitude = 0.25
+
+type tone struct {
+	base
+	frequency float64
+}
+
+func (t *tone) Properties() []prop.Media {
+	return []prop.Media{
+		{
+			Audio: prop.Audio{
+				SampleRate:   48000,
+				Latency:      time.Millisecond * 20,
+				ChannelCount: 1,
+			},
+		},
+		{
+			Audio: prop.Audio{
+				SampleRate:   48000,
+				Latency:      time.Millisecond * 20,
+				ChannelCount: 2,
+			},
+		},
+	}
+}
+
+func (t *tone) AudioRecord(p prop.Media) (audio.Reader, error) {
+	if p.Latency == 0 {
+		p.Latency = 20 * time.Millisecond
+	}
+
+	samples := int(uint64(p.SampleRate) * uint64(p.Latency) / uint64(time.Second))
+	step := 2 * math.Pi * t.frequency / float64(p.SampleRate)
+	nextReadTime := time.Now()
+	closed := t.closed
+	phase := 0.0
+
+	reader := audio.ReaderFunc(func() (wave.Audio, func(), error) {
+		select {
+		case <-closed:
+			return nil, func() {}, io.EOF
+		default:
+		}
+
+		time.Sleep(time.Until(nextReadTime))
+		nextReadTime = nextReadTime.Add(p.Latency)
+
+		chunk := wave.NewFloat32Interleaved(
+			wave.ChunkInfo{
+				Channels:     p.ChannelCount,
+				Len:          samples,
+				SamplingRate: p.SampleRate,
+			},
+		)
+
+		for i := 0; i < samples; i++ {
+			sample := wave.Float32Sample(math.Sin(phase) * toneAmplitude)
+
+			for ch := 0; ch < p.ChannelCount; ch++ {
+				chunk.SetFloat32(i, ch, sample)
+			}
+
+			phase = math.Mod(phase+step, 2*math.Pi)
+		}
+
+		return chunk, func() {}, nil
+	})
+
+	return reader, nil
+}
@@ -0,0 +1,77 @@
+// Package synthetic provides generated media devices for running without a camera or a microphone
+package synthetic
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/pion/mediadevices/pkg/driver"
+)
+
+const (
+	// TestPatternLabel is the device label of the generated video, could be used in place of a camera device
+	TestPatternLabel = "test_pattern"
+	// ToneLabel is the device label of the generated audio, could be used in place of a microphone device
+	ToneLabel = "tone"
+
+	// defaultTestPatternLabel is burned in along with the bot IDs when the label is not set
+	defaultTestPatternLabel = "bot_box"
+)
+
+// registeredPattern is updated with the bot IDs once the arena is configured
+var registeredPattern *testPattern
+
+type base struct {
+	closed <-chan struct{}
+	cancel func()
+}
+
+func (b *base) Open() error {
+	ctx, cancel := context.WithCancel(context.Background())
+	b.closed = ctx.Done()
+	b.cancel = cancel
+	return nil
+}
+
+func (b *base) Close() error {
+	b.cancel()
+	return nil
+}
+
+// RegisterTestPattern adds the test pattern camera, the label is burned into the video along with the timestamp.
+// When the label is empty the bot IDs are burned in, see SetTestPatternBots
+func RegisterTestPattern(label string) {
+	registeredPattern = &testPattern{label: label, isDefaultLabel: label == ""}
+
+	if label == "" {
+		registeredPattern.label = defaultTestPatternLabel
+	}
+
+	driver.GetManager().Register(
+		registeredPattern,
+		driver.Info{Label: TestPatternLabel, DeviceType: driver.Camera, Priority: driver.PriorityLow},
+	)
+}
+
+// SetTestPatternBots burns the IDs of the bots into the test pattern without the label set
+func SetTestPatternBots(count int) {
+	if registeredPattern == nil || !registeredPattern.isDefaultLabel || count < 1 {
+		return
+	}
+
+	label := fmt.Sprintf("%s bot 0", defaultTestPatternLabel)
+
+	if count > 1 {
+		label = fmt.Sprintf("%s bots 0-%d", defaultTestPatternLabel, count-1)
+	}
+
+	registeredPattern.setLabel(label)
+}
+
+// RegisterTone adds the sine tone microphone
+func RegisterTone(frequency float64) {
+	driver.GetManager().Register(
+		&tone{frequency: frequency},
+		driver.Info{Label: ToneLabel, DeviceType: driver.Microphone, Priority: driver.PriorityLow},
+	)
+}
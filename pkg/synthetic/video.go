@@ -0,0 +1,140 @@
+package synthetic
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/pion/mediadevices/pkg/frame"
+	"github.com/pion/mediadevices/pkg/io/video"
+	"github.com/pion/mediadevices/pkg/prop"
+
+	"github.com/roboportal/bot_box/pkg/osd"
+)
+
+var testPatternSizes = [][2]int{
+	{640, 480},
+	{800, 600},
+	{1280, 720},
+	{1920, 1080},
+}
+
+var testPatternFrameRates = []float32{15, 30}
+
+var colorBars = []color.RGBA{
+	{192, 192, 192, 255},
+	{192, 192, 0, 255},
+	{0, 192, 192, 255},
+	{0, 192, 0, 255},
+	{192, 0, 192, 255},
+	{192, 0, 0, 255},
+	{0, 0, 192, 255},
+}
+
+type testPattern struct {
+	base
+	mu             sync.Mutex
+	label          string
+	isDefaultLabel bool
+}
+
+func (t *testPattern) setLabel(label string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.label = label
+}
+
+func (t *testPattern) getLabel() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.label
+}
+
+func (t *testPattern) Properties() []prop.Media {
+	props := make([]prop.Media, 0, len(testPatternSizes)*len(testPatternFrameRates))
+
+	for _, size := range testPatternSizes {
+		for _, frameRate := range testPatternFrameRates {
+			props = append(props, prop.Media{
+				Video: prop.Video{
+					Width:       size[0],
+					Height:      size[1],
+					FrameRate:   frameRate,
+					FrameFormat: frame.FormatRGBA,
+				},
+			})
+		}
+	}
+
+	return props
+}
+
+func drawColorBars(img *image.RGBA) {
+	bounds := img.Bounds()
+	barsEnd := bounds.Dy() * 3 / 4
+
+	for i, c := range colorBars {
+		bar := image.Rect(bounds.Dx()*i/len(colorBars), 0, bounds.Dx()*(i+1)/len(colorBars), barsEnd)
+		draw.Draw(img, bar, &image.Uniform{c}, image.Point{}, draw.Src)
+	}
+
+	draw.Draw(img, image.Rect(0, barsEnd, bounds.Dx(), bounds.Dy()), &image.Uniform{color.RGBA{16, 16, 16, 255}}, image.Point{}, draw.Src)
+}
+
+func (t *testPattern) VideoRecord(p prop.Media) (video.Reader, error) {
+	if p.FrameRate <= 0 {
+		p.FrameRate = 30
+	}
+
+	background := image.NewRGBA(image.Rect(0, 0, p.Width, p.Height))
+	drawColorBars(background)
+
+	scale := p.Width / 320
+
+	if scale < 1 {
+		scale = 1
+	}
+
+	interval := time.Duration(float32(time.Second) / p.FrameRate)
+	nextFrameTime := time.Now()
+	closed := t.closed
+	count := 0
+
+	reader := video.ReaderFunc(func() (image.Image, func(), error) {
+		select {
+		case <-closed:
+			return nil, func() {}, io.EOF
+		default:
+		}
+
+		time.Sleep(time.Until(nextFrameTime))
+		nextFrameTime = nextFrameTime.Add(interval)
+
+		img := image.NewRGBA(background.Rect)
+		copy(img.Pix, background.Pix)
+
+		// moving marker makes frozen video noticeable
+		barsEnd := p.Height * 3 / 4
+		markerSize := (p.Height - barsEnd) / 2
+		x := count * 4 % (p.Width - markerSize)
+		marker := image.Rect(x, barsEnd+markerSize/2, x+markerSize, barsEnd+markerSize/2+markerSize)
+		draw.Draw(img, marker, image.White, image.Point{}, draw.Src)
+
+		lineHeight := osd.LineHeight(scale)
+		osd.DrawText(img, t.getLabel(), image.Pt(lineHeight/2, lineHeight/2), scale)
+		osd.DrawText(img, time.Now().Format("2006-01-02 15:04:05.000"), image.Pt(lineHeight/2, lineHeight*3/2), scale)
+		osd.DrawText(img, fmt.Sprintf("frame %d", count), image.Pt(lineHeight/2, lineHeight*5/2), scale)
+
+		count++
+
+		return img, func() {}, nil
+	})
+
+	return reader, nil
+}
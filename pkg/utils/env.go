@@ -0,0 +1,84 @@
+package utils
+
+import (
+	"os"
+	"strconv"
+	"strings"
+)
+
+// GetEnvString returns the value of the env variable or defaultValue when it is not set
+func GetEnvString(key string, defaultValue string) string {
+	value, ok := os.LookupEnv(key)
+
+	if !ok || value == "" {
+		return defaultValue
+	}
+
+	return value
+}
+
+// GetEnvInt parses the env variable as an integer, panics when the value is malformed
+func GetEnvInt(key string, defaultValue int) int {
+	value := GetEnvString(key, "")
+
+	if value == "" {
+		return defaultValue
+	}
+
+	parsed, err := strconv.ParseInt(value, 10, 32)
+
+	if err != nil {
+		panic(err)
+	}
+
+	return int(parsed)
+}
+
+// GetEnvFloat parses the env variable as a float, panics when the value is malformed
+func GetEnvFloat(key string, defaultValue float64) float64 {
+	value := GetEnvString(key, "")
+
+	if value == "" {
+		return defaultValue
+	}
+
+	parsed, err := strconv.ParseFloat(value, 64)
+
+	if err != nil {
+		panic(err)
+	}
+
+	return parsed
+}
+
+// GetEnvBool parses the env variable as a boolean, panics when the value is malformed
+func GetEnvBool(key string, defaultValue bool) bool {
+	value := GetEnvString(key, "")
+
+	if value == "" {
+		return defaultValue
+	}
+
+	parsed, err := strconv.ParseBool(value)
+
+	if err != nil {
+		panic(err)
+	}
+
+	return parsed
+}
+
+// GetEnvList splits comma-separated env variable into trimmed non-empty items
+func GetEnvList(key string) []string {
+	list := make([]string, 0)
+
+	for _, item := range strings.Split(GetEnvString(key, ""), ",") {
+		item = strings.TrimSpace(item)
+
+		if item != "" {
+			list = append(list, item)
+		}
+	}
+
+	return list
+}